@@ -0,0 +1,72 @@
+package v1
+
+import (
+	"strings"
+)
+
+const (
+	// DefaultMethod is the HTTP method used for endpoints without a method, as in KrakenD
+	DefaultMethod = "GET"
+	// DefaultTimeout is the timeout used for endpoints without a timeout, the service-level timeout of the KrakenD chart
+	DefaultTimeout = "3s"
+)
+
+// KrakendName returns the name of the Krakend targeted by the ApiEndpoints, which defaults to the name of the namespace
+func (a *ApiEndpoints) KrakendName() string {
+	if a.Spec.Krakend == "" {
+		return a.Namespace
+	}
+	return a.Spec.Krakend
+}
+
+// Default sets the defaults of the ApiEndpoints, so that the spec reflects the configuration rendered for KrakenD
+func (a *ApiEndpoints) Default() {
+	a.Spec.Krakend = a.KrakendName()
+	for i := range a.Spec.Endpoints {
+		a.Spec.Endpoints[i].Default()
+	}
+	for i := range a.Spec.OpenEndpoints {
+		a.Spec.OpenEndpoints[i].Default()
+	}
+}
+
+// Default sets the default method and timeout of the endpoint and normalizes its paths
+func (e *Endpoint) Default() {
+	if e.Method == "" {
+		e.Method = DefaultMethod
+	}
+	e.Method = strings.ToUpper(e.Method)
+	if e.TimeOut == "" {
+		e.TimeOut = DefaultTimeout
+	}
+	e.Path = NormalizePath(e.Path)
+	if e.BackendPath != "" {
+		e.BackendPath = leadingSlash(e.BackendPath)
+	}
+	for i := range e.Backends {
+		if e.Backends[i].Path != "" {
+			e.Backends[i].Path = leadingSlash(e.Backends[i].Path)
+		}
+	}
+}
+
+// NormalizePath returns the path with a leading slash and without a trailing slash, except for the root path
+func NormalizePath(path string) string {
+	if path == "" {
+		return path
+	}
+	path = leadingSlash(path)
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// leadingSlash returns the path with a leading slash, trailing slashes in backend paths are left as is
+// as they may be significant to the backend
+func leadingSlash(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
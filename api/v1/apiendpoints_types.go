@@ -20,7 +20,64 @@ type Endpoint struct {
 	QueryParams []string `json:"queryParams,omitempty" fake:"{word}" fakesize:"1"`
 	// Timeout is the timeout for the whole duration of the request/response pipe, see https://www.krakend.io/docs/endpoints/#timeout
 	// Valid duration units are: ns (nanosec.), us or µs (microsec.), ms (millisec.), s (sec.), m (minutes), h (hours).
+	// Defaults to 3s, the service-level timeout of KrakenD.
 	TimeOut string `json:"timeout,omitempty" fake:"10s"`
+	// Backends is a list of backends whose responses are aggregated into one response, see https://www.krakend.io/docs/endpoints/response-manipulation/#aggregation-and-merging
+	// If specified, BackendHost and BackendPath are ignored
+	Backends []Backend `json:"backends,omitempty" fakesize:"1"`
+	// Auth overrides the common Auth of the ApiEndpoints for this endpoint, only supported for endpoints in Endpoints
+	Auth *Auth `json:"auth,omitempty" fake:"skip"`
+	// RateLimit overrides the common RateLimit of the ApiEndpoints for this endpoint
+	RateLimit *RateLimit `json:"rateLimit,omitempty" fake:"skip"`
+	// BackendRateLimit overrides the common BackendRateLimit of the ApiEndpoints for the backends of this endpoint
+	BackendRateLimit *BackendRateLimit `json:"backendRateLimit,omitempty" fake:"skip"`
+	// CircuitBreaker overrides the common CircuitBreaker of the ApiEndpoints for the backends of this endpoint
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty" fake:"skip"`
+	// Cache enables in-memory caching of the backend responses of this endpoint
+	Cache *Cache `json:"cache,omitempty" fake:"skip"`
+}
+
+// Cache defines the in-memory cache for backend responses, see https://www.krakend.io/docs/backends/caching/
+// Responses are cached according to the Cache-Control header returned by the backend, and are not cached if the backend does not allow it
+type Cache struct {
+	// Shared makes the cache shared between all endpoints calling the same backend URL, instead of one cache per endpoint
+	Shared bool `json:"shared,omitempty" fake:"false"`
+	// MaxItems is the maximum number of responses kept in the cache, unlimited if not set
+	MaxItems int `json:"maxItems,omitempty" fake:"1000"`
+	// MaxSize is the maximum size of the cache in bytes, unlimited if not set
+	MaxSize int `json:"maxSize,omitempty" fake:"10485760"`
+}
+
+// Backend defines a backend (upstream) of an endpoint, see https://www.krakend.io/docs/backends/
+type Backend struct {
+	// Hosts is a list of base URLs of the backend service, requests are load balanced between them using round-robin.
+	// Each host must start with the protocol, i.e. http:// or https://
+	//+kubebuilder:validation:MinItems=1
+	Hosts []string `json:"hosts" fake:"http://appname.namespace.svc.cluster.local" fakesize:"1"`
+	// Path is the path of the backend service and follows the conventions of url_pattern in https://www.krakend.io/docs/backends/#backendupstream-configuration
+	Path string `json:"path,omitempty" fake:"{inputname}"`
+	// Method is the HTTP method used against the backend, defaults to the method of the endpoint
+	Method string `json:"method,omitempty" fake:"GET"`
+	// Group wraps the backend response in an attribute with the given name, see https://www.krakend.io/docs/backends/data-manipulation/#grouping
+	Group string `json:"group,omitempty" fake:"{word}"`
+	// Target extracts the data inside the given attribute of the backend response, see https://www.krakend.io/docs/backends/data-manipulation/#target
+	Target string `json:"target,omitempty" fake:"skip"`
+	// Allow is a list of attributes to keep from the backend response, see https://www.krakend.io/docs/backends/data-manipulation/#filtering
+	Allow []string `json:"allow,omitempty" fake:"skip"`
+	// Deny is a list of attributes to remove from the backend response, see https://www.krakend.io/docs/backends/data-manipulation/#filtering
+	Deny []string `json:"deny,omitempty" fake:"skip"`
+}
+
+// AllBackendHosts returns the hosts of all backends of the endpoint, including BackendHost
+func (e Endpoint) AllBackendHosts() []string {
+	hosts := make([]string, 0)
+	if e.BackendHost != "" && len(e.Backends) == 0 {
+		hosts = append(hosts, e.BackendHost)
+	}
+	for _, b := range e.Backends {
+		hosts = append(hosts, b.Hosts...)
+	}
+	return hosts
 }
 
 // RateLimit defines the rate limit configuration
@@ -39,12 +96,42 @@ type RateLimit struct {
 	Capacity int `json:"capacity,omitempty" fake:"1000"`
 	// ClientCapacity is documented here: https://www.krakend.io/docs/endpoints/rate-limit/#configuration
 	ClientCapacity int `json:"clientCapacity,omitempty" fake:"{number:10,100}"`
+	// Disabled turns off rate limiting, e.g. to disable the common rate limit for a single endpoint
+	Disabled bool `json:"disabled,omitempty" fake:"false"`
+}
+
+// BackendRateLimit defines the rate limit towards the backends of an endpoint, see https://www.krakend.io/docs/backends/rate-limit/
+type BackendRateLimit struct {
+	// MaxRate is the maximum number of requests per Every sent to each backend instance
+	MaxRate int `json:"maxRate,omitempty" fake:"100"`
+	// Capacity is the number of requests that can be sent to the backend at once, defaults to MaxRate
+	Capacity int `json:"capacity,omitempty" fake:"100"`
+	// Every is the time window of MaxRate, defaults to 1s
+	Every string `json:"every,omitempty" fake:"1s"`
+	// Disabled turns off backend rate limiting, e.g. to disable the common backend rate limit for a single endpoint
+	Disabled bool `json:"disabled,omitempty" fake:"false"`
+}
+
+// CircuitBreaker defines the circuit breaker for the backends of an endpoint, see https://www.krakend.io/docs/backends/circuit-breaker/
+type CircuitBreaker struct {
+	// Interval is the time window in seconds where errors are counted
+	Interval int `json:"interval,omitempty" fake:"60"`
+	// Timeout is the time in seconds to wait before testing the backend again after the circuit has opened
+	Timeout int `json:"timeout,omitempty" fake:"10"`
+	// MaxErrors is the number of consecutive errors within Interval before the circuit opens
+	MaxErrors int `json:"maxErrors,omitempty" fake:"5"`
+	// LogStatusChange logs changes of the circuit state
+	LogStatusChange bool `json:"logStatusChange,omitempty" fake:"true"`
+	// Disabled turns off the circuit breaker, e.g. to disable the common circuit breaker for a single endpoint
+	Disabled bool `json:"disabled,omitempty" fake:"false"`
 }
 
-// Auth defines the JWT authentication config
+// Auth defines the JWT authentication config, or API key authentication with ApiKeys
 type Auth struct {
-	// Name is the name of the auth provider defined in the Krakend resource, e.g. maskinporten
-	Name string `json:"name" fake:"maskinporten"`
+	// Name is the name of the auth provider defined in the Krakend resource, e.g. maskinporten, required unless ApiKeys is set
+	Name string `json:"name,omitempty" fake:"maskinporten"`
+	// ApiKeys authenticates with the API keys of the Krakend instead of a JWT, requires KrakenD Enterprise
+	ApiKeys *ApiKeysAuth `json:"apiKeys,omitempty" fake:"skip"`
 	// Cache is whether to cache the JWKs from the auth provider
 	Cache bool `json:"cache,omitempty" fake:"true"`
 	// Debug is whether to enable debug logging for the auth provider
@@ -53,6 +140,44 @@ type Auth struct {
 	Audience []string `json:"audience,omitempty" fake:"{uuid}" fakesize:"1"`
 	// Scope is the list of scopes to validate the JWT against
 	Scope []string `json:"scopes,omitempty" fake:"{word}" fakesize:"1"`
+	// RequireClaims is a list of rules on the values of claims which the JWT must all satisfy, in the form
+	// <claim> == <value>, <claim> != <value>, <claim> in [<values>] or <claim> not in [<values>], e.g.
+	// consumer.ID in ["0192:889640782"] to only allow a Maskinporten consumer. Values are compared as strings.
+	RequireClaims []string `json:"requireClaims,omitempty" fake:"skip"`
+	// Claims overrides the claim settings of the auth provider
+	Claims `json:",inline"`
+}
+
+// ApiKeysAuth defines the API keys accepted by endpoints
+type ApiKeysAuth struct {
+	// Roles is the list of roles of which the API key must have at least one
+	//+kubebuilder:validation:MinItems=1
+	Roles []string `json:"roles"`
+}
+
+// Claims configures how the claims of a JWT are validated and propagated, set on an AuthProvider and overridden in Auth
+type Claims struct {
+	// ScopesKey is the claim with the scopes validated against Auth.Scope, e.g. scp for delegated scopes or roles for
+	// app roles in Azure AD. Nested claims are separated with dots. Defaults to scope.
+	ScopesKey string `json:"scopesKey,omitempty" fake:"skip"`
+	// ScopesMatcher is whether any or all of the scopes are required in the JWT, defaults to any
+	//+kubebuilder:validation:Enum=any;all
+	ScopesMatcher string `json:"scopesMatcher,omitempty" fake:"skip"`
+	// RolesKey is the claim with the roles validated against Roles, nested claims are separated with dots. Defaults to roles.
+	RolesKey string `json:"rolesKey,omitempty" fake:"skip"`
+	// Roles is the list of roles of which the JWT must have at least one, e.g. app roles in Azure AD
+	Roles []string `json:"roles,omitempty" fake:"skip"`
+	// PropagateClaims is the list of claims of the JWT sent to the backends as headers, which are forwarded by the endpoints
+	// in addition to ForwardHeaders
+	PropagateClaims []PropagateClaim `json:"propagateClaims,omitempty" fake:"skip"`
+}
+
+// PropagateClaim sends a claim of the JWT to the backends in a header
+type PropagateClaim struct {
+	// Claim is the name of the claim, nested claims are separated with dots, e.g. sub or consumer.ID
+	Claim string `json:"claim"`
+	// Header is the name of the header with the value of the claim, e.g. X-User
+	Header string `json:"header"`
 }
 
 // ApiEndpointsSpec defines the desired state of ApiEndpoints
@@ -65,6 +190,10 @@ type ApiEndpointsSpec struct {
 	Auth Auth `json:"auth,omitempty"`
 	// RateLimit is the common rate limit configuration used for the endpoints specified in Endpoints and OpenEndpoints
 	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+	// BackendRateLimit is the common rate limit towards the backends of the endpoints specified in Endpoints and OpenEndpoints
+	BackendRateLimit *BackendRateLimit `json:"backendRateLimit,omitempty"`
+	// CircuitBreaker is the common circuit breaker for the backends of the endpoints specified in Endpoints and OpenEndpoints
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty"`
 	// Endpoints is a list of endpoints that require authentication
 	Endpoints []Endpoint `json:"endpoints,omitempty" fakesize:"1"`
 	// OpenEndpoints is a list of endpoints that do not require authentication
@@ -73,12 +202,21 @@ type ApiEndpointsSpec struct {
 
 // ApiEndpointsStatus defines the observed state of ApiEndpoints
 type ApiEndpointsStatus struct {
-	SynchronizationTimestamp metav1.Time `json:"synchronizationTimestamp,omitempty"`
-	SynchronizationHash      string      `json:"synchronizationHash,omitempty"`
+	// ObservedGeneration is the most recent generation of the ApiEndpoints processed by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions represent the latest observations of the ApiEndpoints' state, see the Condition* constants for known types
+	//+listType=map
+	//+listMapKey=type
+	//+optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Krakend",type=string,JSONPath=`.spec.krakend`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ApiEndpoints is the Schema for the apiendpoints API
 type ApiEndpoints struct {
@@ -0,0 +1,32 @@
+package v1
+
+// Condition types set on the status of Krakend and ApiEndpoints resources
+const (
+	// ConditionReady is true when the resource has been fully reconciled
+	ConditionReady = "Ready"
+	// ConditionConfigRendered is true when the KrakenD configuration for the resource has been rendered and stored, for
+	// ApiEndpoints when their endpoints are stored in the partials ConfigMaps of the Krakend
+	ConditionConfigRendered = "ConfigRendered"
+	// ConditionNetworkPolicyReady is true when the network policies for the resource have been created or updated
+	ConditionNetworkPolicyReady = "NetworkPolicyReady"
+	// ConditionAuthResolved is true when the auth provider referenced by an ApiEndpoints exists in its Krakend
+	ConditionAuthResolved = "AuthResolved"
+	// ConditionPartialsReady is true when the endpoints of the ApiEndpoints targeting a Krakend are stored in its partials ConfigMaps
+	ConditionPartialsReady = "PartialsReady"
+)
+
+// Condition reasons set on the status of Krakend and ApiEndpoints resources
+const (
+	ReasonReconciled           = "Reconciled"
+	ReasonKrakendNotFound      = "KrakendNotFound"
+	ReasonAuthProviderNotFound = "AuthProviderNotFound"
+	ReasonAuthProviderFound    = "AuthProviderFound"
+	ReasonInvalidSpec          = "InvalidSpec"
+	ReasonRenderFailed         = "RenderFailed"
+	ReasonRendered             = "Rendered"
+	ReasonResourcesFailed      = "ResourcesFailed"
+	ReasonNetworkPolicyFailed  = "NetworkPolicyFailed"
+	ReasonNetworkPolicyApplied = "NetworkPolicyApplied"
+	ReasonPartialsNearLimit    = "PartialsNearLimit"
+	ReasonPartialsTooLarge     = "PartialsTooLarge"
+)
@@ -16,25 +16,66 @@ type KrakendSpec struct {
 	AuthProviders []AuthProvider `json:"authProviders,omitempty" fakesize:"1"`
 	// Deployment defines configuration for the KrakenD deployment
 	Deployment KrakendDeployment `json:"deployment,omitempty"`
+	// Partials configures how the endpoints of the ApiEndpoints are stored in the partials ConfigMaps of KrakenD
+	Partials Partials `json:"partials,omitempty"`
+	// ApiKeys are the API keys accepted by ApiEndpoints with apiKeys auth. They require a KrakenD Enterprise image,
+	// with repository krakend-ee in deployment.image, e.g. krakend/krakend-ee, see
+	// https://www.krakend.io/docs/enterprise/authentication/api-keys/
+	ApiKeys *ApiKeys `json:"apiKeys,omitempty" fake:"skip"`
+}
+
+// ApiKeys defines the API keys of a Krakend and how clients send them
+type ApiKeys struct {
+	// Strategy is how clients send the key, in a header or a query string, defaults to header
+	//+kubebuilder:validation:Enum=header;query_string
+	Strategy string `json:"strategy,omitempty"`
+	// Identifier is the name of the header or query string with the key, defaults to Authorization
+	Identifier string `json:"identifier,omitempty"`
+	// Keys is the list of API keys, with the key material in Secrets. KrakenD is restarted when any of the Secrets
+	// changes, so rotated keys are used without restarting it manually.
+	Keys []ApiKey `json:"keys"`
+}
+
+// ApiKey is an API key and the roles it grants
+type ApiKey struct {
+	// Name identifies the key, e.g. the partner using it
+	Name string `json:"name"`
+	// SecretKeyRef is the key of a Secret in the namespace of the Krakend with the API key, mounted into KrakenD
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
+	// Roles are the roles granted by the key, matched against the roles required by ApiEndpoints
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Partials defines how the endpoints of the ApiEndpoints are stored for KrakenD
+type Partials struct {
+	// Shards is the number of additional ConfigMaps the endpoints are split across, with a partial file per ApiEndpoints,
+	// for Krakends with more endpoints than fit in the 1 MiB of a single ConfigMap. When 0, all endpoints are stored
+	// in a single partial file in the partials ConfigMap.
+	//+kubebuilder:validation:Minimum=0
+	//+kubebuilder:validation:Maximum=16
+	Shards int `json:"shards,omitempty"`
 }
 
 // AuthProvider defines the configuration for an JWT auth provider
 type AuthProvider struct {
 	// Name is the name of the auth provider, e.g. maskinporten
 	Name string `json:"name"`
-	// Alg is the algorithm used for signing the JWT token, e.g. RS256
-	Alg string `json:"alg"`
+	// Alg is the algorithm used for signing the JWT token, defaults to RS256
+	Alg string `json:"alg,omitempty"`
 	// JwkUrl is the URL to the JWKs for the auth provider
 	JwkUrl string `json:"jwkUrl"`
 	// Issuer is the issuer of the JWT token
 	Issuer string `json:"issuer"`
+	// Claims configures the claims of the JWTs of the auth provider, which can be overridden in the Auth of ApiEndpoints
+	Claims `json:",inline"`
 }
 
 // KrakendDeployment defines the configuration for the KrakenD deployment
 type KrakendDeployment struct {
 	// DeploymentType is the type of deployment to use, either deployment or rollout
 	DeploymentType string `json:"deploymentType,omitempty"`
-	// ReplicaCount is the number of replicas to use for the deployment
+	// ReplicaCount is the number of replicas to use for the deployment. When unset, or when a HorizontalPodAutoscaler
+	// targets the deployment, the current replicas of the deployment are kept.
 	ReplicaCount int `json:"replicaCount,omitempty"`
 	// Resources is the resource requirements for the deployment, as in corev1.ResourceRequirements
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
@@ -86,12 +127,30 @@ type Image struct {
 
 // KrakendStatus defines the observed state of Krakend
 type KrakendStatus struct {
-	SynchronizationTimestamp metav1.Time `json:"synchronizationTimestamp,omitempty"`
-	SynchronizationHash      string      `json:"synchronizationHash,omitempty"`
+	// ObservedGeneration is the most recent generation of the Krakend processed by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ManagedResources is the list of resources rendered from the KrakenD chart in the last reconciliation,
+	// resources no longer rendered by the chart are deleted
+	ManagedResources []ManagedResource `json:"managedResources,omitempty"`
+	// Conditions represent the latest observations of the Krakend's state, see the Condition* constants for known types
+	//+listType=map
+	//+listMapKey=type
+	//+optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// ManagedResource is a reference to a resource managed by the Krakend
+type ManagedResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Krakend is the Schema for the krakends API
 type Krakend struct {
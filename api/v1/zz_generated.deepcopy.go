@@ -22,6 +22,7 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -93,6 +94,16 @@ func (in *ApiEndpointsSpec) DeepCopyInto(out *ApiEndpointsSpec) {
 		*out = new(RateLimit)
 		**out = **in
 	}
+	if in.BackendRateLimit != nil {
+		in, out := &in.BackendRateLimit, &out.BackendRateLimit
+		*out = new(BackendRateLimit)
+		**out = **in
+	}
+	if in.CircuitBreaker != nil {
+		in, out := &in.CircuitBreaker, &out.CircuitBreaker
+		*out = new(CircuitBreaker)
+		**out = **in
+	}
 	if in.Endpoints != nil {
 		in, out := &in.Endpoints, &out.Endpoints
 		*out = make([]Endpoint, len(*in))
@@ -122,7 +133,13 @@ func (in *ApiEndpointsSpec) DeepCopy() *ApiEndpointsSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ApiEndpointsStatus) DeepCopyInto(out *ApiEndpointsStatus) {
 	*out = *in
-	in.SynchronizationTimestamp.DeepCopyInto(&out.SynchronizationTimestamp)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApiEndpointsStatus.
@@ -135,9 +152,77 @@ func (in *ApiEndpointsStatus) DeepCopy() *ApiEndpointsStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApiKey) DeepCopyInto(out *ApiKey) {
+	*out = *in
+	in.SecretKeyRef.DeepCopyInto(&out.SecretKeyRef)
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApiKey.
+func (in *ApiKey) DeepCopy() *ApiKey {
+	if in == nil {
+		return nil
+	}
+	out := new(ApiKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApiKeys) DeepCopyInto(out *ApiKeys) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]ApiKey, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApiKeys.
+func (in *ApiKeys) DeepCopy() *ApiKeys {
+	if in == nil {
+		return nil
+	}
+	out := new(ApiKeys)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApiKeysAuth) DeepCopyInto(out *ApiKeysAuth) {
+	*out = *in
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApiKeysAuth.
+func (in *ApiKeysAuth) DeepCopy() *ApiKeysAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(ApiKeysAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Auth) DeepCopyInto(out *Auth) {
 	*out = *in
+	if in.ApiKeys != nil {
+		in, out := &in.ApiKeys, &out.ApiKeys
+		*out = new(ApiKeysAuth)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Audience != nil {
 		in, out := &in.Audience, &out.Audience
 		*out = make([]string, len(*in))
@@ -148,6 +233,12 @@ func (in *Auth) DeepCopyInto(out *Auth) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.RequireClaims != nil {
+		in, out := &in.RequireClaims, &out.RequireClaims
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Claims.DeepCopyInto(&out.Claims)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Auth.
@@ -163,6 +254,7 @@ func (in *Auth) DeepCopy() *Auth {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AuthProvider) DeepCopyInto(out *AuthProvider) {
 	*out = *in
+	in.Claims.DeepCopyInto(&out.Claims)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthProvider.
@@ -175,6 +267,106 @@ func (in *AuthProvider) DeepCopy() *AuthProvider {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Backend) DeepCopyInto(out *Backend) {
+	*out = *in
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Allow != nil {
+		in, out := &in.Allow, &out.Allow
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Deny != nil {
+		in, out := &in.Deny, &out.Deny
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Backend.
+func (in *Backend) DeepCopy() *Backend {
+	if in == nil {
+		return nil
+	}
+	out := new(Backend)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendRateLimit) DeepCopyInto(out *BackendRateLimit) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendRateLimit.
+func (in *BackendRateLimit) DeepCopy() *BackendRateLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendRateLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Cache) DeepCopyInto(out *Cache) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Cache.
+func (in *Cache) DeepCopy() *Cache {
+	if in == nil {
+		return nil
+	}
+	out := new(Cache)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CircuitBreaker) DeepCopyInto(out *CircuitBreaker) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CircuitBreaker.
+func (in *CircuitBreaker) DeepCopy() *CircuitBreaker {
+	if in == nil {
+		return nil
+	}
+	out := new(CircuitBreaker)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Claims) DeepCopyInto(out *Claims) {
+	*out = *in
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PropagateClaims != nil {
+		in, out := &in.PropagateClaims, &out.PropagateClaims
+		*out = make([]PropagateClaim, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Claims.
+func (in *Claims) DeepCopy() *Claims {
+	if in == nil {
+		return nil
+	}
+	out := new(Claims)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Endpoint) DeepCopyInto(out *Endpoint) {
 	*out = *in
@@ -188,6 +380,38 @@ func (in *Endpoint) DeepCopyInto(out *Endpoint) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Backends != nil {
+		in, out := &in.Backends, &out.Backends
+		*out = make([]Backend, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(Auth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(RateLimit)
+		**out = **in
+	}
+	if in.BackendRateLimit != nil {
+		in, out := &in.BackendRateLimit, &out.BackendRateLimit
+		*out = new(BackendRateLimit)
+		**out = **in
+	}
+	if in.CircuitBreaker != nil {
+		in, out := &in.CircuitBreaker, &out.CircuitBreaker
+		*out = new(CircuitBreaker)
+		**out = **in
+	}
+	if in.Cache != nil {
+		in, out := &in.Cache, &out.Cache
+		*out = new(Cache)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Endpoint.
@@ -354,9 +578,17 @@ func (in *KrakendSpec) DeepCopyInto(out *KrakendSpec) {
 	if in.AuthProviders != nil {
 		in, out := &in.AuthProviders, &out.AuthProviders
 		*out = make([]AuthProvider, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	in.Deployment.DeepCopyInto(&out.Deployment)
+	out.Partials = in.Partials
+	if in.ApiKeys != nil {
+		in, out := &in.ApiKeys, &out.ApiKeys
+		*out = new(ApiKeys)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KrakendSpec.
@@ -372,7 +604,18 @@ func (in *KrakendSpec) DeepCopy() *KrakendSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KrakendStatus) DeepCopyInto(out *KrakendStatus) {
 	*out = *in
-	in.SynchronizationTimestamp.DeepCopyInto(&out.SynchronizationTimestamp)
+	if in.ManagedResources != nil {
+		in, out := &in.ManagedResources, &out.ManagedResources
+		*out = make([]ManagedResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KrakendStatus.
@@ -385,6 +628,36 @@ func (in *KrakendStatus) DeepCopy() *KrakendStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedResource) DeepCopyInto(out *ManagedResource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedResource.
+func (in *ManagedResource) DeepCopy() *ManagedResource {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Partials) DeepCopyInto(out *Partials) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Partials.
+func (in *Partials) DeepCopy() *Partials {
+	if in == nil {
+		return nil
+	}
+	out := new(Partials)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Path) DeepCopyInto(out *Path) {
 	*out = *in
@@ -400,6 +673,21 @@ func (in *Path) DeepCopy() *Path {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PropagateClaim) DeepCopyInto(out *PropagateClaim) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PropagateClaim.
+func (in *PropagateClaim) DeepCopy() *PropagateClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(PropagateClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RateLimit) DeepCopyInto(out *RateLimit) {
 	*out = *in
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nais/krakend/internal/helm"
+	"github.com/nais/krakend/internal/krakend"
+	"github.com/nais/krakend/internal/lint"
+	"github.com/nais/krakend/internal/render"
+	log "github.com/sirupsen/logrus"
+)
+
+const usage = `krakendctl is a tool for working with Krakend and ApiEndpoints manifests
+
+Usage:
+  krakendctl <command> [flags] <file or directory>...
+
+Commands:
+  lint    validate manifests as the admission webhooks would, and print the rendered endpoints
+  render  render the complete krakend.json of a Krakend and its ApiEndpoints, as loaded by KrakenD
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "lint":
+		os.Exit(lintCmd(os.Args[2:]))
+	case "render":
+		os.Exit(renderCmd(os.Args[2:]))
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+func lintCmd(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	namespace := fs.String("namespace", "default", "Namespace of resources without a namespace")
+	quiet := fs.Bool("quiet", false, "Only print problems, not the rendered endpoints")
+	authProviders := fs.String("auth-providers", "", "Path to the catalogue of auth providers available to all Krakends, as configured for the operator")
+	debug := fs.Bool("debug", false, "Enable debug logging")
+	_ = fs.Parse(args)
+
+	setupLogging(*debug)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "lint: at least one file or directory is required")
+		return 2
+	}
+	catalogue, err := loadAuthProviders(*authProviders)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lint: %v\n", err)
+		return 2
+	}
+
+	result, err := lint.Lint(fs.Args(), *namespace, catalogue)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lint: %v\n", err)
+		return 2
+	}
+
+	for _, p := range result.Problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+
+	if !*quiet {
+		out, err := json.MarshalIndent(result.Partials, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "lint: %v\n", err)
+			return 2
+		}
+		fmt.Println(string(out))
+	}
+
+	if len(result.Problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func renderCmd(args []string) int {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	namespace := fs.String("namespace", "default", "Namespace of resources without a namespace")
+	name := fs.String("krakend", "", "The Krakend to render, as namespace/name, required if the manifests contain more than one")
+	chartPath := fs.String("chart", "installer/krakend", "Path to the KrakenD chart used by the operator")
+	output := fs.String("o", "", "Write the config to this file instead of stdout")
+	authProviders := fs.String("auth-providers", "", "Path to the catalogue of auth providers available to all Krakends, as configured for the operator")
+	debug := fs.Bool("debug", false, "Enable debug logging")
+	_ = fs.Parse(args)
+
+	setupLogging(*debug)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "render: at least one file or directory is required")
+		return 2
+	}
+	catalogue, err := loadAuthProviders(*authProviders)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		return 2
+	}
+
+	result, err := lint.Lint(fs.Args(), *namespace, catalogue)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		return 2
+	}
+	// the config would not match what the operator deploys if any manifests are rejected
+	if len(result.Problems) > 0 {
+		for _, p := range result.Problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		return 1
+	}
+
+	key, err := selectKrakend(result, *name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		return 2
+	}
+
+	chart, err := helm.LoadChart(*chartPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render: loading chart: %v\n", err)
+		return 2
+	}
+	config, err := render.KrakendConfig(chart, result.Krakends[key], catalogue, result.ApiEndpoints[key])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		return 2
+	}
+
+	if *output == "" {
+		fmt.Println(string(config))
+		return 0
+	}
+	if err := os.WriteFile(*output, append(config, '\n'), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// selectKrakend returns the namespace/name of the Krakend to render, which may be omitted if there is only one
+func selectKrakend(result *lint.Result, name string) (string, error) {
+	keys := make([]string, 0, len(result.Krakends))
+	for k := range result.Krakends {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if name != "" {
+		if _, ok := result.Krakends[name]; !ok {
+			return "", fmt.Errorf("krakend %q not found, found: %s", name, strings.Join(keys, ", "))
+		}
+		return name, nil
+	}
+	switch len(keys) {
+	case 0:
+		return "", fmt.Errorf("no Krakend found in the manifests")
+	case 1:
+		return keys[0], nil
+	default:
+		return "", fmt.Errorf("found more than one Krakend, select one with -krakend: %s", strings.Join(keys, ", "))
+	}
+}
+
+// setupLogging keeps the output of the validation, which logs as in the operator, to errors unless debugging
+func setupLogging(debug bool) {
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.ErrorLevel)
+	if debug {
+		log.SetLevel(log.DebugLevel)
+	}
+}
+
+// loadAuthProviders reads the catalogue of auth providers from the file, if any
+func loadAuthProviders(file string) (krakend.AuthProviderCatalogue, error) {
+	if file == "" {
+		return nil, nil
+	}
+	return krakend.LoadAuthProviderCatalogue(file)
+}
@@ -9,6 +9,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/nais/krakend/internal/helm"
+	"github.com/nais/krakend/internal/krakend"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -18,6 +19,7 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -55,6 +57,7 @@ func main() {
 	var interval time.Duration
 	var krakendChartPath string
 	var netpolEnabled bool
+	var authProvidersPath string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -62,9 +65,10 @@ func main() {
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.BoolVar(&debug, "debug", os.Getenv("DEBUG") == "true", "Enable debug logging")
-	flag.DurationVar(&interval, "sync-interval", 1*time.Minute, "Synchronization interval for reconciliation")
+	flag.DurationVar(&interval, "sync-interval", 10*time.Minute, "Resync period of the cache, in which all Krakends and ApiEndpoints are reconciled")
 	flag.StringVar(&krakendChartPath, "krakend-chart-path", envOrDefault("KRAKEND_CHART_PATH", "charts/krakend-chart"), "Path to krakend helm chart")
 	flag.BoolVar(&netpolEnabled, "netpol-enabled", os.Getenv("NETPOL_ENABLED") == "true", "Enable network policies")
+	flag.StringVar(&authProvidersPath, "auth-providers", os.Getenv("AUTH_PROVIDERS_PATH"), "Path to a YAML catalogue of auth providers available to all Krakends")
 
 	opts := zap.Options{
 		Development: true,
@@ -82,6 +86,7 @@ func main() {
 		Scheme:                 scheme,
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
+		Cache:                  cache.Options{SyncPeriod: &interval},
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "dbcb84f2.nais.io",
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
@@ -107,11 +112,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	var authProviders krakend.AuthProviderCatalogue
+	if authProvidersPath != "" {
+		authProviders, err = krakend.LoadAuthProviderCatalogue(authProvidersPath)
+		if err != nil {
+			setupLog.Error(err, "unable to load auth provider catalogue")
+			os.Exit(1)
+		}
+		log.Infof("loaded %d auth providers from catalogue %s", len(authProviders), authProvidersPath)
+	}
+
 	if err = (&controller.KrakendReconciler{
 		Client:        mgr.GetClient(),
 		Scheme:        mgr.GetScheme(),
 		Recorder:      mgr.GetEventRecorderFor("krakend-operator"),
-		SyncInterval:  interval,
 		KrakendChart:  krakendChart,
 		NetpolEnabled: netpolEnabled,
 	}).SetupWithManager(mgr); err != nil {
@@ -121,17 +135,34 @@ func main() {
 	if err = (&controller.ApiEndpointsReconciler{
 		Client:        mgr.GetClient(),
 		Scheme:        mgr.GetScheme(),
-		SyncInterval:  interval,
 		NetpolEnabled: netpolEnabled,
+		AuthProviders: authProviders,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ApiEndpoints")
 		os.Exit(1)
 	}
+	if err = (&controller.PartialsReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		Recorder:      mgr.GetEventRecorderFor("krakend-operator"),
+		AuthProviders: authProviders,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Partials")
+		os.Exit(1)
+	}
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err = (&webhook.ApiEndpointsValidator{}).SetupWebhookWithManager(mgr); err != nil {
+		if err = (&webhook.ApiEndpointsDefaulter{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ApiEndpointsDefaulter")
+			os.Exit(1)
+		}
+		if err = (&webhook.ApiEndpointsValidator{AuthProviders: authProviders}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "ApiEndpoints")
 			os.Exit(1)
 		}
+		if err = (&webhook.KrakendValidator{AuthProviders: authProviders}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Krakend")
+			os.Exit(1)
+		}
 	}
 	//+kubebuilder:scaffold:builder
 
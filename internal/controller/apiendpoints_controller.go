@@ -18,34 +18,36 @@ package controller
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"github.com/mitchellh/hashstructure/v2"
 	krakendv1 "github.com/nais/krakend/api/v1"
 	"github.com/nais/krakend/internal/krakend"
 	"github.com/nais/krakend/internal/netpol"
 	log "github.com/sirupsen/logrus"
-	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"net/url"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"strings"
-	"time"
 )
 
 // ApiEndpointsReconciler reconciles a ApiEndpoints object
 type ApiEndpointsReconciler struct {
 	client.Client
 	Scheme        *runtime.Scheme
-	SyncInterval  time.Duration
 	NetpolEnabled bool
 	ClusterDomain string
+	// AuthProviders is the catalogue of auth providers available to the ApiEndpoints of all Krakends
+	AuthProviders krakend.AuthProviderCatalogue
 }
 
 const (
@@ -69,31 +71,12 @@ func (r *ApiEndpointsReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	krakendName := endpoints.Spec.Krakend
-	if krakendName == "" {
-		krakendName = endpoints.Namespace
-	}
+	krakendName := endpoints.KrakendName()
 
 	if endpoints.GetDeletionTimestamp() != nil {
+		// the endpoints are removed from the partials ConfigMap by the PartialsReconciler when it observes the deletion
 		log.Debugf("Resource %s is marked for deletion", endpoints.Name)
 
-		k := &krakendv1.Krakend{}
-		err := r.Get(ctx, types.NamespacedName{
-			Name:      krakendName,
-			Namespace: endpoints.Namespace,
-		}, k)
-		if err != nil {
-			if !errors.IsNotFound(err) {
-				return ctrl.Result{}, err
-			}
-			log.Debugf("krakend '%s' not found, nothing to do but remove finalizers", krakendName)
-		} else {
-			err = r.updateKrakendConfigMap(ctx, k)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
-		}
-
 		if controllerutil.RemoveFinalizer(endpoints, KrakendFinalizer) {
 			err := r.Update(ctx, endpoints)
 			if err != nil {
@@ -103,39 +86,38 @@ func (r *ApiEndpointsReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, nil
 	}
 
-	hash, err := hashEndpoints(endpoints.Spec)
-	if err != nil {
-		return ctrl.Result{}, err
-	}
-
-	// skip reconciliation if hash is unchanged and timestamp is within sync interval
-	// reconciliation is triggered when status subresource is updated, so we need this check to avoid infinite loop
-	if endpoints.Status.SynchronizationHash == hash && !r.needsSync(endpoints.Status.SynchronizationTimestamp.Time) {
-		log.Debugf("skipping reconciliation of %q, hash %q is unchanged and changed within syncInterval window", endpoints.Name, hash)
-		return ctrl.Result{}, nil
-	} else {
-		log.Debugf("reconciling: hash changed: %v, outside syncInterval window: %v", endpoints.Status.SynchronizationHash != hash, r.needsSync(endpoints.Status.SynchronizationTimestamp.Time))
-	}
-
 	k := &krakendv1.Krakend{}
-	err = r.Get(ctx, types.NamespacedName{
+	err := r.Get(ctx, types.NamespacedName{
 		Name:      krakendName,
 		Namespace: endpoints.Namespace,
 	}, k)
 	if err != nil {
+		if errors.IsNotFound(err) {
+			r.updateStatusConditions(ctx, endpoints, failedConditions(krakendv1.ConditionReady, krakendv1.ReasonKrakendNotFound, err)...)
+		}
 		return ctrl.Result{}, fmt.Errorf("get Krakend instance '%s': %v", krakendName, err)
 	}
-	err = r.updateKrakendConfigMap(ctx, k)
-	if err != nil {
-		log.Errorf("updating Krakend configmap: %v", err)
-		return ctrl.Result{}, err
+
+	if _, err := krakend.ToKrakendEndpoints(k, r.AuthProviders, []krakendv1.ApiEndpoints{*endpoints}); err != nil {
+		if krakend.IsAuthProviderNotFound(err) {
+			r.updateStatusConditions(ctx, endpoints, failedConditions(krakendv1.ConditionAuthResolved, krakendv1.ReasonAuthProviderNotFound, err)...)
+		} else {
+			r.updateStatusConditions(ctx, endpoints, failedConditions(krakendv1.ConditionConfigRendered, krakendv1.ReasonRenderFailed, err)...)
+		}
+		return ctrl.Result{}, fmt.Errorf("convert ApiEndpoints to Krakend endpoints: %v", err)
+	}
+	conditions := []metav1.Condition{
+		condition(krakendv1.ConditionAuthResolved, metav1.ConditionTrue, krakendv1.ReasonAuthProviderFound, ""),
 	}
+	// ConfigRendered is set to true by the PartialsReconciler once the endpoints are stored in the partials ConfigMap
 
 	if r.NetpolEnabled {
 		if err := r.ensureAppIngressNetpol(ctx, endpoints); err != nil {
 			log.Errorf("creating/updating netpol: %v", err)
+			r.updateStatusConditions(ctx, endpoints, failedConditions(krakendv1.ConditionNetworkPolicyReady, krakendv1.ReasonNetworkPolicyFailed, err)...)
 			return ctrl.Result{}, nil
 		}
+		conditions = append(conditions, condition(krakendv1.ConditionNetworkPolicyReady, metav1.ConditionTrue, krakendv1.ReasonNetworkPolicyApplied, ""))
 	}
 
 	// refetch to avoid the issue "the object has been modified, please apply
@@ -171,8 +153,12 @@ func (r *ApiEndpointsReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		log.Error(err, "refetching resource after update")
 		return ctrl.Result{}, err
 	}
-	endpoints.Status.SynchronizationTimestamp = metav1.Now()
-	endpoints.Status.SynchronizationHash = hash
+	endpoints.Status.ObservedGeneration = endpoints.Generation
+	conditions = append(conditions, condition(krakendv1.ConditionReady, metav1.ConditionTrue, krakendv1.ReasonReconciled, ""))
+	setConditions(&endpoints.Status.Conditions, endpoints.Generation, conditions...)
+	if !r.NetpolEnabled {
+		meta.RemoveStatusCondition(&endpoints.Status.Conditions, krakendv1.ConditionNetworkPolicyReady)
+	}
 	if err := r.Status().Update(ctx, endpoints); err != nil {
 		return ctrl.Result{}, err
 	}
@@ -180,31 +166,67 @@ func (r *ApiEndpointsReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	return ctrl.Result{}, nil
 }
 
+// updateStatusConditions sets the given conditions on the ApiEndpoints status, and persists them if they changed
+func (r *ApiEndpointsReconciler) updateStatusConditions(ctx context.Context, endpoints *krakendv1.ApiEndpoints, conditions ...metav1.Condition) {
+	recordFailure("apiendpoints", conditions)
+	changed := setConditions(&endpoints.Status.Conditions, endpoints.Generation, conditions...)
+	if endpoints.Status.ObservedGeneration != endpoints.Generation {
+		endpoints.Status.ObservedGeneration = endpoints.Generation
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if err := r.Status().Update(ctx, endpoints); err != nil {
+		log.Errorf("updating status conditions for ApiEndpoints '%s': %v", endpoints.Name, err)
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ApiEndpointsReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&krakendv1.ApiEndpoints{}).
+		// status and metadata updates, e.g. adding the finalizer, do not change the generation,
+		// so they do not trigger a new reconciliation. Marking the object for deletion does.
+		For(&krakendv1.ApiEndpoints{}, builder.WithPredicates(generationChangedOrResync)).
+		Owns(&v1.NetworkPolicy{}).
+		Watches(
+			&krakendv1.Krakend{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForKrakend),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
 		Complete(r)
 }
 
+// requestsForKrakend enqueues all ApiEndpoints targeting the Krakend, e.g. to resolve auth providers again when they change
+func (r *ApiEndpointsReconciler) requestsForKrakend(ctx context.Context, obj client.Object) []reconcile.Request {
+	k, ok := obj.(*krakendv1.Krakend)
+	if !ok {
+		return nil
+	}
+	list := &krakendv1.ApiEndpointsList{}
+	if err := r.List(ctx, list, client.InNamespace(k.Namespace)); err != nil {
+		log.Errorf("list ApiEndpoints for Krakend '%s': %v", k.Name, err)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0)
+	for _, a := range apiEndpointsForKrakend(k, list.Items) {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      a.Name,
+				Namespace: a.Namespace,
+			},
+		})
+	}
+	return requests
+}
+
 func (r *ApiEndpointsReconciler) ensureAppIngressNetpol(ctx context.Context, endpoints *krakendv1.ApiEndpoints) error {
 	apps := r.appsInNamespace(endpoints)
 	log.Debugf("ensuring ingress netpols for apps: %v", apps)
 	for _, app := range apps {
-		ownerRef := []metav1.OwnerReference{
-			{
-				APIVersion: endpoints.APIVersion,
-				Kind:       endpoints.Kind,
-				Name:       endpoints.Name,
-				UID:        endpoints.UID,
-			},
-		}
+		ownerRef := []metav1.OwnerReference{controllerRef(endpoints)}
 
-		krakendName := endpoints.Spec.Krakend
-		if krakendName == "" {
-			krakendName = endpoints.Namespace
-		}
-		npName := fmt.Sprintf("%s-%s-%s", "allow", krakendName, app)
+		npName := fmt.Sprintf("%s-%s-%s", "allow", endpoints.KrakendName(), app)
 
 		np := &v1.NetworkPolicy{}
 		err := r.Get(ctx, types.NamespacedName{
@@ -244,10 +266,14 @@ func (r *ApiEndpointsReconciler) appsInNamespace(endpoints *krakendv1.ApiEndpoin
 	// used to remove duplicates
 	seen := make(map[string]bool)
 	apps := make([]string, 0)
+	hosts := make([]string, 0)
 	for _, e := range endpoints.Spec.Endpoints {
-		u, err := url.Parse(e.BackendHost)
+		hosts = append(hosts, e.AllBackendHosts()...)
+	}
+	for _, host := range hosts {
+		u, err := url.Parse(host)
 		if err != nil {
-			log.Warnf("failed to parse backend host %s in ApiEndpoints %s, skipping: %v", e.BackendHost, endpoints.Name, err)
+			log.Warnf("failed to parse backend host %s in ApiEndpoints %s, skipping: %v", host, endpoints.Name, err)
 			continue
 		}
 		// only support http for service discovery
@@ -278,66 +304,3 @@ func (r *ApiEndpointsReconciler) appsInNamespace(endpoints *krakendv1.ApiEndpoin
 	}
 	return apps
 }
-
-func (r *ApiEndpointsReconciler) updateKrakendConfigMap(ctx context.Context, k *krakendv1.Krakend) error {
-	log.Debugf("updating ConfigMap for Krakend '%s'", k.Name)
-
-	cm := &corev1.ConfigMap{}
-	cmName := fmt.Sprintf("%s-%s-%s", k.Name, "krakend", "partials")
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      cmName,
-		Namespace: k.Namespace,
-	}, cm)
-	if err != nil {
-		return fmt.Errorf("get ConfigMap '%s': %v", cmName, err)
-	}
-
-	key := KrakendConfigMapKey
-	ep := cm.Data[key]
-	if ep == "" {
-		return fmt.Errorf("%s not found in ConfigMap with name %s", key, cmName)
-	}
-
-	list := &krakendv1.ApiEndpointsList{}
-	if err = r.List(ctx, list, client.InNamespace(k.Namespace)); err != nil {
-		return fmt.Errorf("list all ApiEndpoints: %v", err)
-	}
-
-	filtered := make([]krakendv1.ApiEndpoints, 0)
-	for _, e := range list.Items {
-		if e.GetDeletionTimestamp() == nil {
-			filtered = append(filtered, e)
-		}
-	}
-
-	allEndpoints, err := krakend.ToKrakendEndpoints(k, filtered)
-	if err != nil {
-		return fmt.Errorf("convert ApiEndpoints to Krakend endpoints: %v", err)
-	}
-	partials, err := json.Marshal(allEndpoints)
-	if err != nil {
-		return err
-	}
-
-	//TODO handle race conditions when updating configmap
-	cm.Data[key] = string(partials)
-	err = r.Update(ctx, cm)
-	if err != nil {
-		return fmt.Errorf("update ConfigMap '%s': %v", cmName, err)
-	}
-
-	return nil
-}
-
-func hashEndpoints(a krakendv1.ApiEndpointsSpec) (string, error) {
-	hash, err := hashstructure.Hash(a, hashstructure.FormatV2, nil)
-	if err != nil {
-		return "", err
-	}
-	return fmt.Sprintf("%x", hash), nil
-}
-
-func (r *ApiEndpointsReconciler) needsSync(timestamp time.Time) bool {
-	window := time.Now().Add(-r.SyncInterval)
-	return timestamp.Before(window)
-}
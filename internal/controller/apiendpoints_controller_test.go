@@ -1,9 +1,14 @@
 package controller
 
 import (
+	"context"
 	krakendv1 "github.com/nais/krakend/api/v1"
 	"github.com/stretchr/testify/assert"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"testing"
 )
 
@@ -76,3 +81,48 @@ func TestAppsInNamespace(t *testing.T) {
 		tc.assertions(apps)
 	}
 }
+
+func TestAppsInNamespaceWithBackends(t *testing.T) {
+	r := &ApiEndpointsReconciler{
+		ClusterDomain: "cluster.local",
+	}
+
+	e := &krakendv1.ApiEndpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "ns1",
+		},
+		Spec: krakendv1.ApiEndpointsSpec{
+			Endpoints: []krakendv1.Endpoint{
+				{
+					BackendHost: "http://ignored",
+					Backends: []krakendv1.Backend{
+						{Hosts: []string{"http://app1", "http://app2.ns1"}},
+						{Hosts: []string{"http://app1", "https://app3.nais.io"}},
+					},
+				},
+			},
+		},
+	}
+	apps := r.appsInNamespace(e)
+	assert.Equal(t, []string{"app1", "app2"}, apps)
+}
+
+func TestRequestsForKrakend(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, krakendv1.AddToScheme(scheme))
+
+	k := &krakendv1.Krakend{ObjectMeta: metav1.ObjectMeta{Name: "ns1", Namespace: "ns1"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		k,
+		&krakendv1.ApiEndpoints{ObjectMeta: metav1.ObjectMeta{Name: "app1", Namespace: "ns1"}},
+		&krakendv1.ApiEndpoints{ObjectMeta: metav1.ObjectMeta{Name: "app2", Namespace: "ns1"}, Spec: krakendv1.ApiEndpointsSpec{Krakend: "other"}},
+		&krakendv1.ApiEndpoints{ObjectMeta: metav1.ObjectMeta{Name: "app3", Namespace: "ns2"}},
+	).Build()
+	r := &ApiEndpointsReconciler{Client: c, Scheme: scheme}
+
+	requests := r.requestsForKrakend(context.Background(), k)
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: "app1", Namespace: "ns1"}},
+	}, requests)
+}
@@ -9,6 +9,7 @@ import (
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -59,7 +60,7 @@ var _ = Describe("ApiEndpoints Controller", func() {
 
 			actual := &krakendv1.ApiEndpoints{ObjectMeta: created.ObjectMeta}
 			Expect(k8sClient.Create(ctx, created)).Should(Succeed())
-			Eventually(getApiEndpoints, timeout, interval).WithArguments(k8sClient, ctx, actual).Should(HaveExistingField("SynchronizationHash"))
+			Eventually(getApiEndpoints, timeout, interval).WithArguments(k8sClient, ctx, actual).Should(HaveField("ObservedGeneration", BeNumerically(">", 0)))
 
 			np := &networkingv1.NetworkPolicyList{}
 			Eventually(func() bool {
@@ -77,6 +78,25 @@ var _ = Describe("ApiEndpoints Controller", func() {
 			}
 
 		})
+
+		It("should set the Ready condition when reconciled", func() {
+			ctx := context.Background()
+			created = apiEndpoints("conditionstest", endpoints("http://app1"))
+
+			actual := &krakendv1.ApiEndpoints{ObjectMeta: created.ObjectMeta}
+			Expect(k8sClient.Create(ctx, created)).Should(Succeed())
+			Eventually(func() bool {
+				status, err := getApiEndpoints(k8sClient, ctx, actual)
+				return err == nil && meta.IsStatusConditionTrue(status.Conditions, krakendv1.ConditionReady)
+			}, timeout, interval).Should(BeTrue())
+			Expect(actual.Status.ObservedGeneration).To(Equal(actual.Generation))
+			Expect(meta.IsStatusConditionTrue(actual.Status.Conditions, krakendv1.ConditionAuthResolved)).To(BeTrue())
+			// set once the endpoints are stored in the partials ConfigMap
+			Eventually(func() bool {
+				status, err := getApiEndpoints(k8sClient, ctx, actual)
+				return err == nil && meta.IsStatusConditionTrue(status.Conditions, krakendv1.ConditionConfigRendered)
+			}, timeout, interval).Should(BeTrue())
+		})
 	})
 })
 
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/metrics"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func condition(conditionType string, status metav1.ConditionStatus, reason, message string) metav1.Condition {
+	return metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+// failedConditions returns the given condition type set to false, together with a false Ready condition using the same reason and message
+func failedConditions(conditionType, reason string, err error) []metav1.Condition {
+	conditions := []metav1.Condition{
+		condition(krakendv1.ConditionReady, metav1.ConditionFalse, reason, err.Error()),
+	}
+	if conditionType != krakendv1.ConditionReady {
+		conditions = append(conditions, condition(conditionType, metav1.ConditionFalse, reason, err.Error()))
+	}
+	return conditions
+}
+
+// setConditions sets the conditions with the given observed generation and returns true if any of them changed
+func setConditions(conditions *[]metav1.Condition, generation int64, newConditions ...metav1.Condition) bool {
+	changed := false
+	for _, c := range newConditions {
+		c.ObservedGeneration = generation
+		if meta.SetStatusCondition(conditions, c) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// recordFailure counts a failed reconciliation with the reason of the Ready condition, if it is false
+func recordFailure(controller string, conditions []metav1.Condition) {
+	for _, c := range conditions {
+		if c.Type == krakendv1.ConditionReady && c.Status == metav1.ConditionFalse {
+			metrics.ReconcileFailures.WithLabelValues(controller, c.Reason).Inc()
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"errors"
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestSetConditions(t *testing.T) {
+	conditions := make([]metav1.Condition, 0)
+
+	changed := setConditions(&conditions, 1, failedConditions(krakendv1.ConditionAuthResolved, krakendv1.ReasonAuthProviderNotFound, errors.New("not found"))...)
+	assert.True(t, changed)
+	assert.Len(t, conditions, 2)
+	assert.True(t, meta.IsStatusConditionFalse(conditions, krakendv1.ConditionReady))
+	assert.True(t, meta.IsStatusConditionFalse(conditions, krakendv1.ConditionAuthResolved))
+	assert.Equal(t, krakendv1.ReasonAuthProviderNotFound, meta.FindStatusCondition(conditions, krakendv1.ConditionReady).Reason)
+	assert.Equal(t, int64(1), meta.FindStatusCondition(conditions, krakendv1.ConditionReady).ObservedGeneration)
+
+	changed = setConditions(&conditions, 1, failedConditions(krakendv1.ConditionAuthResolved, krakendv1.ReasonAuthProviderNotFound, errors.New("not found"))...)
+	assert.False(t, changed, "setting the same conditions again should not report a change")
+
+	changed = setConditions(&conditions, 2,
+		condition(krakendv1.ConditionAuthResolved, metav1.ConditionTrue, krakendv1.ReasonAuthProviderFound, ""),
+		condition(krakendv1.ConditionReady, metav1.ConditionTrue, krakendv1.ReasonReconciled, ""),
+	)
+	assert.True(t, changed)
+	assert.True(t, meta.IsStatusConditionTrue(conditions, krakendv1.ConditionReady))
+	assert.Equal(t, int64(2), meta.FindStatusCondition(conditions, krakendv1.ConditionAuthResolved).ObservedGeneration)
+}
+
+func TestFailedConditionsReadyOnly(t *testing.T) {
+	conditions := failedConditions(krakendv1.ConditionReady, krakendv1.ReasonKrakendNotFound, errors.New("krakend not found"))
+	assert.Len(t, conditions, 1)
+	assert.Equal(t, krakendv1.ConditionReady, conditions[0].Type)
+	assert.Equal(t, "krakend not found", conditions[0].Message)
+}
+
+func TestRecordFailure(t *testing.T) {
+	counter := metrics.ReconcileFailures.WithLabelValues("test", krakendv1.ReasonAuthProviderNotFound)
+	before := testutil.ToFloat64(counter)
+
+	recordFailure("test", failedConditions(krakendv1.ConditionAuthResolved, krakendv1.ReasonAuthProviderNotFound, errors.New("not found")))
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+
+	recordFailure("test", []metav1.Condition{condition(krakendv1.ConditionReady, metav1.ConditionTrue, krakendv1.ReasonReconciled, "")})
+	assert.Equal(t, before+1, testutil.ToFloat64(counter), "a ready condition is not a failure")
+}
@@ -18,27 +18,33 @@ package controller
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	hashstructure "github.com/mitchellh/hashstructure/v2"
 	krakendv1 "github.com/nais/krakend/api/v1"
 	"github.com/nais/krakend/internal/helm"
+	"github.com/nais/krakend/internal/metrics"
 	"github.com/nais/krakend/internal/netpol"
+	"github.com/nais/krakend/internal/render"
 	log "github.com/sirupsen/logrus"
 	"helm.sh/helm/v3/pkg/chartutil"
 	v1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"time"
 )
 
@@ -47,76 +53,83 @@ type KrakendReconciler struct {
 	client.Client
 	Scheme        *runtime.Scheme
 	Recorder      record.EventRecorder
-	SyncInterval  time.Duration
 	KrakendChart  *helm.Chart
 	NetpolEnabled bool
 }
 
-const DefaultKrakendIngressClass = "nais-ingress-external"
+const (
+	DefaultKrakendIngressClass = "nais-ingress-external"
+	// FieldManager is the field manager used when applying resources rendered from the KrakenD chart
+	FieldManager = "krakend-operator"
+)
 
 //TODO: add more finegrained permissions
 
 // +kubebuilder:rbac:groups=krakend.nais.io,resources=krakends,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=krakend.nais.io,resources=krakends/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=krakend.nais.io,resources=krakends/finalizers,verbs=update
-// +kubebuilder:rbac:groups="*",resources=*,verbs=create;update;patch;get;list;watch
+// +kubebuilder:rbac:groups="*",resources=*,verbs=create;update;patch;get;list;watch;delete
 
 func (r *KrakendReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log.Infof("reconciling krakend %s", req.NamespacedName)
 	ns := req.Namespace
 	k := &krakendv1.Krakend{}
 	err := r.Get(ctx, req.NamespacedName, k)
-	if err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+	if errors.IsNotFound(err) {
+		metrics.DeleteKrakend(req.Namespace, req.Name)
+		return ctrl.Result{}, nil
 	}
-
-	hash, err := hash(k.Spec)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	// skip reconciliation if hash is unchanged and timestamp is within sync interval
-	// reconciliation is triggered when status subresource is updated, so we need this check to avoid infinite loop
-	if k.Status.SynchronizationHash == hash && !r.needsSync(k.Status.SynchronizationTimestamp.Time) {
-		log.Debugf("skipping reconciliation of %q, hash %q is unchanged and changed within syncInterval window", k.Name, hash)
+	if k.GetDeletionTimestamp() != nil {
+		// owned resources are garbage collected by the API server
 		return ctrl.Result{}, nil
-	} else {
-		log.Debugf("reconciling: hash changed: %v, outside syncInterval window: %v", k.Status.SynchronizationHash != hash, r.needsSync(k.Status.SynchronizationTimestamp.Time))
 	}
 
 	releaseName := k.Name
 	releaseNamespace := k.Namespace
 
-	values, err := prepareValues(k)
+	values, err := render.ChartValues(k)
 	if err != nil {
+		r.updateStatusConditions(ctx, k, failedConditions(krakendv1.ConditionConfigRendered, krakendv1.ReasonInvalidSpec, err)...)
 		return ctrl.Result{}, fmt.Errorf("preparing values: %w", err)
 	}
 
+	start := time.Now()
 	resources, err := r.KrakendChart.ToUnstructured(releaseName, releaseNamespace, chartutil.Values{
 		"krakend": values,
 	})
+	metrics.HelmRenderDuration.Observe(time.Since(start).Seconds())
 
 	if err != nil {
+		r.updateStatusConditions(ctx, k, failedConditions(krakendv1.ConditionConfigRendered, krakendv1.ReasonRenderFailed, err)...)
 		return ctrl.Result{}, fmt.Errorf("rendering helm chart: %w", err)
 	}
-
-	ownerRef := []metav1.OwnerReference{
-		{
-			APIVersion: k.APIVersion,
-			Kind:       k.Kind,
-			Name:       k.Name,
-			UID:        k.UID,
-		},
+	conditions := []metav1.Condition{
+		condition(krakendv1.ConditionConfigRendered, metav1.ConditionTrue, krakendv1.ReasonRendered, ""),
 	}
 
+	ownerRef := []metav1.OwnerReference{controllerRef(k)}
+
+	failed := make([]string, 0)
+	managed := make([]krakendv1.ManagedResource, 0)
 	for _, resource := range resources {
+		managed = append(managed, krakendv1.ManagedResource{
+			APIVersion: resource.GetAPIVersion(),
+			Kind:       resource.GetKind(),
+			Name:       resource.GetName(),
+		})
+
 		log.Debugf("creating resource of kind: %s with name: %s", resource.GetKind(), resource.GetName())
 
 		if resource.GetKind() == "Deployment" {
-			addAnnotations(resource, map[string]string{"reloader.stakater.com/search": "true"})
+			addAnnotations(resource, deploymentAnnotations(k))
 			d := &v1.Deployment{}
 			err = runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, d)
 			if err != nil {
+				r.updateStatusConditions(ctx, k, failedConditions(krakendv1.ConditionConfigRendered, krakendv1.ReasonRenderFailed, err)...)
 				return ctrl.Result{}, fmt.Errorf("converting unstructured to deployment: %w", err)
 			}
 
@@ -127,11 +140,18 @@ func (r *KrakendReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 				existing = append(existing, k.Spec.Deployment.ExtraEnvVars...)
 				d.Spec.Template.Spec.Containers[0].Env = existing
 			}
+			if k.Spec.Partials.Shards > 0 || k.Spec.ApiKeys != nil {
+				projectPartialsVolume(d, k)
+			}
+			if err := r.keepReplicas(ctx, k, ns, d); err != nil {
+				return ctrl.Result{}, err
+			}
 			d.Spec.Template.Labels["logs.nais.io/flow-loki"] = "true"
 			d.Spec.Template.Annotations["kubectl.kubernetes.io/default-container"] = d.Name
 
 			m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(d)
 			if err != nil {
+				r.updateStatusConditions(ctx, k, failedConditions(krakendv1.ConditionConfigRendered, krakendv1.ReasonRenderFailed, err)...)
 				return ctrl.Result{}, fmt.Errorf("converting deployment to unstructured: %w", err)
 			}
 			resource.Object = m
@@ -140,6 +160,13 @@ func (r *KrakendReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		if resource.GetKind() == "ConfigMap" {
 			addAnnotations(resource, map[string]string{"reloader.stakater.com/match": "true"})
 
+			if resource.GetName() == render.ConfigName(k) {
+				if err := rewriteConfig(resource, k); err != nil {
+					r.updateStatusConditions(ctx, k, failedConditions(krakendv1.ConditionConfigRendered, krakendv1.ReasonRenderFailed, err)...)
+					return ctrl.Result{}, fmt.Errorf("rewriting config: %w", err)
+				}
+			}
+
 			var cm corev1.ConfigMap
 			err := r.Get(ctx, types.NamespacedName{
 				Name:      resource.GetName(),
@@ -159,30 +186,85 @@ func (r *KrakendReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 
 		resource.SetNamespace(ns)
 		resource.SetOwnerReferences(ownerRef)
-		err := r.createOrUpdate(ctx, resource)
+		err := r.apply(ctx, resource)
 		if err != nil {
 			r.Recorder.Eventf(k, "Warning", "CreateResource", "Unable to create resource %v/%v for namespace %q: %v", resource.GetKind(), resource.GetName(), ns, err)
+			failed = append(failed, fmt.Sprintf("%v/%v", resource.GetKind(), resource.GetName()))
+			continue
+		}
+		log.Debugf("applied resource %v/%v for namespace %q", resource.GetKind(), resource.GetName(), ns)
+	}
+
+	for _, stale := range staleResources(k.Status.ManagedResources, managed) {
+		if err := r.prune(ctx, k, stale); err != nil {
+			r.Recorder.Eventf(k, "Warning", "DeleteResource", "Unable to delete resource %v/%v for namespace %q: %v", stale.Kind, stale.Name, ns, err)
+			failed = append(failed, fmt.Sprintf("%v/%v", stale.Kind, stale.Name))
+			// keep track of the resource to retry deletion in the next synchronization
+			managed = append(managed, stale)
 			continue
 		}
-		log.Debugf("created resource %v/%v for namespace %q", resource.GetKind(), resource.GetName(), ns)
+		log.Infof("deleted resource %v/%v no longer rendered for namespace %q", stale.Kind, stale.Name, ns)
 	}
 
 	if r.NetpolEnabled {
 		if err := r.ensureKrakendNetpol(ctx, k, releaseName); err != nil {
+			r.updateStatusConditions(ctx, k, failedConditions(krakendv1.ConditionNetworkPolicyReady, krakendv1.ReasonNetworkPolicyFailed, err)...)
 			return ctrl.Result{}, fmt.Errorf("ensuring krakend egress netpol: %w", err)
 		}
+		conditions = append(conditions, condition(krakendv1.ConditionNetworkPolicyReady, metav1.ConditionTrue, krakendv1.ReasonNetworkPolicyApplied, ""))
+	} else {
+		meta.RemoveStatusCondition(&k.Status.Conditions, krakendv1.ConditionNetworkPolicyReady)
+	}
+
+	if len(failed) > 0 {
+		conditions = append(conditions, condition(krakendv1.ConditionReady, metav1.ConditionFalse, krakendv1.ReasonResourcesFailed, fmt.Sprintf("unable to create or update resources: %s", strings.Join(failed, ", "))))
+	} else {
+		conditions = append(conditions, condition(krakendv1.ConditionReady, metav1.ConditionTrue, krakendv1.ReasonReconciled, ""))
 	}
 
-	k.Status.SynchronizationTimestamp = metav1.Now()
-	k.Status.SynchronizationHash = hash
+	recordFailure("krakend", conditions)
+	k.Status.ObservedGeneration = k.Generation
+	k.Status.ManagedResources = managed
+	setConditions(&k.Status.Conditions, k.Generation, conditions...)
 	if err := r.Status().Update(ctx, k); err != nil {
 		r.Recorder.Eventf(k, "Warning", "UpdateStatus", "Unable to update status for %q: %v", k.Name, err)
 		return ctrl.Result{}, err
 	}
+	if len(failed) == 0 {
+		metrics.LastSuccessfulSync.WithLabelValues(k.Namespace, k.Name).SetToCurrentTime()
+	}
 
+	// changes to the Krakend and its owned resources are picked up by watches, the resync of the cache corrects drift
+	// in resources not watched, e.g. when the chart renders kinds other than the ones owned by this controller
 	return ctrl.Result{}, nil
 }
 
+// updateStatusConditions sets the given conditions on the Krakend status, and persists them if they changed
+func (r *KrakendReconciler) updateStatusConditions(ctx context.Context, k *krakendv1.Krakend, conditions ...metav1.Condition) {
+	recordFailure("krakend", conditions)
+	changed := setConditions(&k.Status.Conditions, k.Generation, conditions...)
+	if k.Status.ObservedGeneration != k.Generation {
+		k.Status.ObservedGeneration = k.Generation
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if err := r.Status().Update(ctx, k); err != nil {
+		r.Recorder.Eventf(k, "Warning", "UpdateStatus", "Unable to update status for %q: %v", k.Name, err)
+	}
+}
+
+// deploymentAnnotations returns the annotations of the Deployment for Reloader, which restarts KrakenD when the annotated
+// ConfigMaps change, and when any Secret mounted into KrakenD changes if the Krakend has API keys, so rotated keys are read
+func deploymentAnnotations(k *krakendv1.Krakend) map[string]string {
+	annotations := map[string]string{"reloader.stakater.com/search": "true"}
+	if k.Spec.ApiKeys != nil {
+		annotations["secret.reloader.stakater.com/auto"] = "true"
+	}
+	return annotations
+}
+
 func addAnnotations(resource *unstructured.Unstructured, annotations map[string]string) {
 	existing := resource.GetAnnotations()
 	if existing == nil {
@@ -194,58 +276,85 @@ func addAnnotations(resource *unstructured.Unstructured, annotations map[string]
 	resource.SetAnnotations(existing)
 }
 
-func prepareValues(k *krakendv1.Krakend) (map[string]any, error) {
-	values, err := toMap(k.Spec.Deployment)
-	if err != nil {
-		return nil, fmt.Errorf("marshalling krakend deployment: %w", err)
+// rewriteConfig changes the config rendered by the chart to read the endpoints from the partial files of the ApiEndpoints,
+// and adds the API keys of the Krakend
+func rewriteConfig(resource *unstructured.Unstructured, k *krakendv1.Krakend) error {
+	data, _, _ := unstructured.NestedFieldNoCopy(resource.Object, "data")
+	m, ok := data.(map[string]any)
+	if !ok {
+		return fmt.Errorf("no data in ConfigMap '%s'", resource.GetName())
 	}
-
-	ingress := k.Spec.Ingress
-	ingressHost := k.Spec.IngressHost
-	if len(ingress.Hosts) == 0 && ingressHost == "" {
-		return nil, fmt.Errorf("either ingressHost or ingress.hosts must be specified")
+	for key, value := range m {
+		config, ok := value.(string)
+		if !ok {
+			continue
+		}
+		config, err := render.IndexedConfig(config)
+		if err != nil {
+			return fmt.Errorf("ConfigMap '%s': %w", resource.GetName(), err)
+		}
+		config, err = render.ApiKeysConfig(config, k)
+		if err != nil {
+			return fmt.Errorf("ConfigMap '%s': %w", resource.GetName(), err)
+		}
+		m[key] = config
 	}
+	return nil
+}
 
-	if len(ingress.Hosts) == 0 && ingressHost != "" {
-		ingress.Hosts = []krakendv1.Host{
-			{
-				Host: ingressHost,
-				Paths: []krakendv1.Path{
-					{
-						Path:     "/",
-						PathType: "ImplementationSpecific",
-					},
+// projectPartialsVolume replaces the partials volume with a projected volume of the partials ConfigMap, its shards and
+// the Secrets of the API keys. Shards are optional as they are created by the PartialsReconciler after the Deployment.
+func projectPartialsVolume(d *v1.Deployment, k *krakendv1.Krakend) {
+	for i, v := range d.Spec.Template.Spec.Volumes {
+		if v.Name != "partials" || v.ConfigMap == nil {
+			continue
+		}
+		sources := []corev1.VolumeProjection{
+			{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: v.ConfigMap.LocalObjectReference}},
+		}
+		for shard := 1; shard <= k.Spec.Partials.Shards; shard++ {
+			sources = append(sources, corev1.VolumeProjection{
+				ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: render.ShardName(k, shard)},
+					Optional:             ptr.To(true),
 				},
+			})
+		}
+		if k.Spec.ApiKeys != nil {
+			for _, key := range k.Spec.ApiKeys.Keys {
+				sources = append(sources, corev1.VolumeProjection{
+					Secret: &corev1.SecretProjection{
+						LocalObjectReference: key.SecretKeyRef.LocalObjectReference,
+						Items:                []corev1.KeyToPath{{Key: key.SecretKeyRef.Key, Path: render.ApiKeyFile(key)}},
+						Optional:             key.SecretKeyRef.Optional,
+					},
+				})
+			}
+		}
+		d.Spec.Template.Spec.Volumes[i] = corev1.Volume{
+			Name: v.Name,
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{Sources: sources},
 			},
 		}
 	}
-	ingressValues, err := toMap(ingress)
-	if err != nil {
-		return nil, fmt.Errorf("preparing ingress values: %w", err)
-	}
-
-	values["ingress"] = ingressValues
-
-	return values, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *KrakendReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&krakendv1.Krakend{}).
+		// status updates do not change the generation, so they do not trigger a new reconciliation
+		For(&krakendv1.Krakend{}, builder.WithPredicates(generationChangedOrResync)).
+		Owns(&v1.Deployment{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.Service{}).
+		Owns(&networkingv1.NetworkPolicy{}).
 		Complete(r)
 }
 
 // TODO: this is temporary set to allow egress to all IPs and not per endpoint, consider creating fqdn policy for each endpoint. If we choose to do this, move this function to apiendpoints controller instead.
 func (r *KrakendReconciler) ensureKrakendNetpol(ctx context.Context, k *krakendv1.Krakend, releaseName string) error {
-	ownerRef := []metav1.OwnerReference{
-		{
-			APIVersion: k.APIVersion,
-			Kind:       k.Kind,
-			Name:       k.Name,
-			UID:        k.UID,
-		},
-	}
+	ownerRef := []metav1.OwnerReference{controllerRef(k)}
 
 	npName := fmt.Sprintf("%s-%s", releaseName, "krakend")
 
@@ -282,54 +391,114 @@ func (r *KrakendReconciler) ensureKrakendNetpol(ctx context.Context, k *krakendv
 	return nil
 }
 
-func toMap(v any) (map[string]any, error) {
-	j, err := json.Marshal(v)
+// keepReplicas keeps the current replicas of an existing Deployment when the Krakend does not set them or an autoscaler
+// scales the Deployment, so applying the replicas of the chart does not reset the scaling
+func (r *KrakendReconciler) keepReplicas(ctx context.Context, k *krakendv1.Krakend, namespace string, d *v1.Deployment) error {
+	scaled, err := r.scaledByAutoscaler(ctx, namespace, d.Name)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if k.Spec.Deployment.ReplicaCount > 0 && !scaled {
+		return nil
+	}
+	current := &v1.Deployment{}
+	err = r.Get(ctx, types.NamespacedName{Name: d.Name, Namespace: namespace}, current)
+	if errors.IsNotFound(err) {
+		return nil
 	}
-	m := make(map[string]any)
-	err = json.Unmarshal(j, &m)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("get Deployment '%s': %w", d.Name, err)
 	}
-	return m, nil
+	d.Spec.Replicas = current.Spec.Replicas
+	return nil
 }
 
-// TODO: diff and update - see nais/replicator for inspiration
-func (r *KrakendReconciler) createOrUpdate(
-	ctx context.Context,
-	resource *unstructured.Unstructured,
-) error {
-	err := r.Create(ctx, resource)
-	if client.IgnoreAlreadyExists(err) != nil {
-		return fmt.Errorf("creating resource: %w", err)
-	}
-	if errors.IsAlreadyExists(err) {
-		existing := &unstructured.Unstructured{}
-		existing.SetGroupVersionKind(resource.GroupVersionKind())
-		err := r.Get(ctx, client.ObjectKeyFromObject(resource), existing)
-		if err != nil {
-			return fmt.Errorf("getting existing resource: %w", err)
+// scaledByAutoscaler returns whether a HorizontalPodAutoscaler targets the Deployment
+func (r *KrakendReconciler) scaledByAutoscaler(ctx context.Context, namespace, deployment string) (bool, error) {
+	hpas := &autoscalingv2.HorizontalPodAutoscalerList{}
+	if err := r.List(ctx, hpas, client.InNamespace(namespace)); err != nil {
+		return false, fmt.Errorf("listing HorizontalPodAutoscalers: %w", err)
+	}
+	for _, hpa := range hpas.Items {
+		ref := hpa.Spec.ScaleTargetRef
+		if ref.Kind == "Deployment" && ref.Name == deployment {
+			return true, nil
 		}
-		resource.SetResourceVersion(existing.GetResourceVersion())
+	}
+	return false, nil
+}
 
-		err = r.Update(ctx, resource)
-		if err != nil {
-			return fmt.Errorf("updating resource: %w", err)
-		}
+// apply creates or updates the resource using server-side apply, unchanged resources are left untouched by the API server
+func (r *KrakendReconciler) apply(ctx context.Context, resource *unstructured.Unstructured) error {
+	resource.SetManagedFields(nil)
+	resource.SetResourceVersion("")
+	err := r.Patch(ctx, resource, client.Apply, client.ForceOwnership, client.FieldOwner(FieldManager))
+	if err != nil {
+		return fmt.Errorf("applying resource: %w", err)
 	}
 	return nil
 }
 
-func hash(k krakendv1.KrakendSpec) (string, error) {
-	hash, err := hashstructure.Hash(k, hashstructure.FormatV2, nil)
+// prune deletes a resource previously rendered from the chart, if it is still owned by the Krakend
+func (r *KrakendReconciler) prune(ctx context.Context, k *krakendv1.Krakend, resource krakendv1.ManagedResource) error {
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion(resource.APIVersion)
+	existing.SetKind(resource.Kind)
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      resource.Name,
+		Namespace: k.Namespace,
+	}, existing)
 	if err != nil {
-		return "", err
+		return client.IgnoreNotFound(err)
+	}
+
+	owned := false
+	for _, ref := range existing.GetOwnerReferences() {
+		if ref.UID == k.UID {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		log.Infof("resource %v/%v is not owned by krakend %q, skipping delete", resource.Kind, resource.Name, k.Name)
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, existing))
+}
+
+// staleResources returns the resources in previous that are not in current
+func staleResources(previous, current []krakendv1.ManagedResource) []krakendv1.ManagedResource {
+	rendered := make(map[krakendv1.ManagedResource]bool)
+	for _, c := range current {
+		rendered[c] = true
 	}
-	return fmt.Sprintf("%x", hash), nil
+	stale := make([]krakendv1.ManagedResource, 0)
+	for _, p := range previous {
+		if !rendered[p] {
+			stale = append(stale, p)
+		}
+	}
+	return stale
 }
 
-func (r *KrakendReconciler) needsSync(timestamp time.Time) bool {
-	window := time.Now().Add(-r.SyncInterval)
-	return timestamp.Before(window)
+// generationChangedOrResync passes changes of the generation, and the periodic resyncs of the cache, in which the object
+// is unchanged, so the resources of the reconciled objects are corrected every SyncPeriod of the manager
+var generationChangedOrResync = predicate.Or(predicate.GenerationChangedPredicate{}, predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return e.ObjectOld.GetResourceVersion() == e.ObjectNew.GetResourceVersion()
+	},
+})
+
+// controllerRef returns an owner reference marking the owner as the managing controller, which is required for
+// changes to the owned resource to be enqueued for the owner
+func controllerRef(owner client.Object) metav1.OwnerReference {
+	gvk := owner.GetObjectKind().GroupVersionKind()
+	return metav1.OwnerReference{
+		APIVersion:         gvk.GroupVersion().String(),
+		Kind:               gvk.Kind,
+		Name:               owner.GetName(),
+		UID:                owner.GetUID(),
+		Controller:         ptr.To(true),
+		BlockOwnerDeletion: ptr.To(true),
+	}
 }
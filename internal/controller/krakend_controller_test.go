@@ -1,16 +1,25 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	krakendv1 "github.com/nais/krakend/api/v1"
 	"github.com/nais/krakend/internal/helm"
+	"github.com/nais/krakend/internal/render"
 	"github.com/stretchr/testify/assert"
 	"helm.sh/helm/v3/pkg/chartutil"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
 	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
 	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"testing"
 )
 
@@ -18,7 +27,7 @@ func TestRenderChart(t *testing.T) {
 	k, err := unmarshallKrakend("testdata/krakend_min.yaml")
 	assert.NoError(t, err)
 
-	values, err := prepareValues(k)
+	values, err := render.ChartValues(k)
 	assert.NoError(t, err)
 
 	c, err := helm.LoadChart("testdata/krakend")
@@ -38,6 +47,26 @@ func TestRenderChart(t *testing.T) {
 	}
 }
 
+func TestStaleResources(t *testing.T) {
+	previous := []krakendv1.ManagedResource{
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "krakend"},
+		{APIVersion: "v1", Kind: "Service", Name: "krakend"},
+		{APIVersion: "policy/v1", Kind: "PodDisruptionBudget", Name: "krakend"},
+	}
+	current := []krakendv1.ManagedResource{
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "krakend"},
+		{APIVersion: "v1", Kind: "Service", Name: "krakend"},
+		{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Name: "krakend"},
+	}
+
+	stale := staleResources(previous, current)
+	assert.Equal(t, []krakendv1.ManagedResource{
+		{APIVersion: "policy/v1", Kind: "PodDisruptionBudget", Name: "krakend"},
+	}, stale)
+
+	assert.Empty(t, staleResources(nil, current))
+}
+
 func unmarshallKrakend(yamlFile string) (*krakendv1.Krakend, error) {
 	sch := runtime.NewScheme()
 	_ = scheme.AddToScheme(sch)
@@ -58,3 +87,143 @@ func unmarshallKrakend(yamlFile string) (*krakendv1.Krakend, error) {
 	}
 	return nil, fmt.Errorf("kind is not krakend")
 }
+
+func TestControllerRef(t *testing.T) {
+	k := &krakendv1.Krakend{
+		TypeMeta:   metav1.TypeMeta{APIVersion: krakendv1.GroupVersion.String(), Kind: "Krakend"},
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1", Namespace: "ns1", UID: "uid"},
+	}
+	ref := controllerRef(k)
+	assert.Equal(t, "krakend.nais.io/v1", ref.APIVersion)
+	assert.Equal(t, "Krakend", ref.Kind)
+	assert.Equal(t, "ns1", ref.Name)
+	assert.True(t, *ref.Controller)
+	assert.True(t, *ref.BlockOwnerDeletion)
+}
+
+func TestRewriteConfigAndProjectPartials(t *testing.T) {
+	k, err := unmarshallKrakend("testdata/krakend_min.yaml")
+	assert.NoError(t, err)
+	k.Spec.Partials.Shards = 2
+	k.Spec.ApiKeys = &krakendv1.ApiKeys{
+		Keys: []krakendv1.ApiKey{{
+			Name: "partner",
+			SecretKeyRef: corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "partner-apikey"},
+				Key:                  "key",
+			},
+			Roles: []string{"read"},
+		}},
+	}
+
+	values, err := render.ChartValues(k)
+	assert.NoError(t, err)
+	c, err := helm.LoadChart("testdata/krakend")
+	assert.NoError(t, err)
+	resources, err := c.ToUnstructured(k.Name, k.Namespace, chartutil.Values{
+		"krakend": values,
+	})
+	assert.NoError(t, err)
+
+	sharded := 0
+	for _, r := range resources {
+		switch {
+		case r.GetKind() == "ConfigMap" && r.GetName() == render.ConfigName(k):
+			assert.NoError(t, rewriteConfig(r, k))
+			sharded++
+			data, _, _ := unstructured.NestedFieldNoCopy(r.Object, "data")
+			for _, config := range data.(map[string]any) {
+				assert.Contains(t, config, render.EndpointsIndex)
+				assert.NotContains(t, config, `{{ include "endpoints.tmpl" }}`)
+				assert.Contains(t, config, `"auth/api-keys":{"keys":[{"@description":"partner","key":{{ include "apikey_partner" | trim | marshal }},"roles":["read"]}]},`)
+			}
+		case r.GetKind() == "Deployment":
+			d := &appsv1.Deployment{}
+			assert.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(r.Object, d))
+			projectPartialsVolume(d, k)
+			for _, v := range d.Spec.Template.Spec.Volumes {
+				if v.Name != "partials" {
+					continue
+				}
+				assert.Nil(t, v.ConfigMap)
+				assert.Len(t, v.Projected.Sources, 4)
+				assert.Equal(t, "team1-min-krakend-partials", v.Projected.Sources[0].ConfigMap.Name)
+				assert.Equal(t, "team1-min-krakend-partials-2", v.Projected.Sources[2].ConfigMap.Name)
+				assert.True(t, *v.Projected.Sources[2].ConfigMap.Optional)
+				assert.Equal(t, "partner-apikey", v.Projected.Sources[3].Secret.Name)
+				assert.Equal(t, []corev1.KeyToPath{{Key: "key", Path: "apikey_partner"}}, v.Projected.Sources[3].Secret.Items)
+				sharded++
+			}
+		}
+	}
+	assert.Equal(t, 2, sharded)
+}
+
+func TestScaledByAutoscaler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, autoscalingv2.AddToScheme(scheme))
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1-krakend", Namespace: "ns1"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "ns1-krakend"},
+			MaxReplicas:    4,
+		},
+	}
+	r := &KrakendReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(hpa).Build()}
+
+	scaled, err := r.scaledByAutoscaler(context.Background(), "ns1", "ns1-krakend")
+	assert.NoError(t, err)
+	assert.True(t, scaled)
+
+	for ns, name := range map[string]string{"ns1": "other-krakend", "ns2": "ns1-krakend"} {
+		scaled, err = r.scaledByAutoscaler(context.Background(), ns, name)
+		assert.NoError(t, err)
+		assert.False(t, scaled)
+	}
+}
+
+func TestKeepReplicas(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, autoscalingv2.AddToScheme(scheme))
+	assert.NoError(t, appsv1.AddToScheme(scheme))
+
+	current := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1-krakend", Namespace: "ns1"},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.To(int32(3))},
+	}
+	r := &KrakendReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(current).Build()}
+
+	for _, tc := range []struct {
+		name         string
+		replicaCount int
+		deployment   string
+		expected     int32
+	}{
+		{name: "keeps the current replicas when unset", deployment: "ns1-krakend", expected: 3},
+		{name: "applies the replicas when set", replicaCount: 2, deployment: "ns1-krakend", expected: 2},
+		{name: "applies the chart replicas to a new deployment", deployment: "ns1-other", expected: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			k := &krakendv1.Krakend{Spec: krakendv1.KrakendSpec{Deployment: krakendv1.KrakendDeployment{ReplicaCount: tc.replicaCount}}}
+			d := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: tc.deployment},
+				Spec:       appsv1.DeploymentSpec{Replicas: ptr.To(int32(2))},
+			}
+			assert.NoError(t, r.keepReplicas(context.Background(), k, "ns1", d))
+			assert.Equal(t, tc.expected, *d.Spec.Replicas)
+		})
+	}
+}
+
+func TestDeploymentAnnotations(t *testing.T) {
+	k := &krakendv1.Krakend{}
+	assert.Equal(t, map[string]string{"reloader.stakater.com/search": "true"}, deploymentAnnotations(k))
+
+	// rotated API keys restart KrakenD without annotating the Secrets of the keys
+	k.Spec.ApiKeys = &krakendv1.ApiKeys{}
+	assert.Equal(t, map[string]string{
+		"reloader.stakater.com/search":      "true",
+		"secret.reloader.stakater.com/auto": "true",
+	}, deploymentAnnotations(k))
+}
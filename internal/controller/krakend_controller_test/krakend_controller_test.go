@@ -10,6 +10,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"time"
 )
@@ -89,7 +90,7 @@ var _ = Describe("Krakend Controller", func() {
 
 			actual := &krakendv1.Krakend{ObjectMeta: created.ObjectMeta}
 			Expect(k8sClient.Create(ctx, created)).Should(Succeed())
-			Eventually(getKrakend, timeout, interval).WithArguments(k8sClient, ctx, actual).Should(HaveExistingField("SynchronizationHash"))
+			Eventually(getKrakend, timeout, interval).WithArguments(k8sClient, ctx, actual).Should(HaveField("ObservedGeneration", BeNumerically(">", 0)))
 
 			d := &v1.Deployment{}
 			Eventually(func() bool {
@@ -101,4 +102,31 @@ var _ = Describe("Krakend Controller", func() {
 			}, timeout, interval).Should(BeTrue())
 		})
 	})
+
+	Context("Scale Krakend", func() {
+		It("should keep the replicas of the Deployment when the Krakend does not set them", func() {
+			ctx := context.Background()
+			spec := fullKrakendSpec()
+			spec.Deployment.ReplicaCount = 0
+			k := krakendResource("default", "team2", spec)
+			Expect(k8sClient.Create(ctx, k)).Should(Succeed())
+
+			key := types.NamespacedName{Namespace: "default", Name: "team2-krakend"}
+			d := &v1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, key, d)
+			}, timeout, interval).Should(Succeed())
+
+			// e.g. an autoscaler scales the Deployment, which changes its generation and reconciles the Krakend
+			d.Spec.Replicas = ptr.To(int32(3))
+			Expect(k8sClient.Update(ctx, d)).Should(Succeed())
+			Eventually(getKrakend, timeout, interval).WithArguments(k8sClient, ctx, k).Should(HaveField("ObservedGeneration", BeNumerically(">", 0)))
+
+			Consistently(func() int32 {
+				scaled := &v1.Deployment{}
+				Expect(k8sClient.Get(ctx, key, scaled)).Should(Succeed())
+				return *scaled.Spec.Replicas
+			}, 2*time.Second, interval).Should(Equal(int32(3)))
+		})
+	})
 })
@@ -19,7 +19,6 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"testing"
-	"time"
 
 	krakendv1 "github.com/nais/krakend/api/v1"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -91,7 +90,6 @@ var _ = BeforeSuite(func() {
 		Client:        k8sManager.GetClient(),
 		Scheme:        k8sManager.GetScheme(),
 		Recorder:      k8sManager.GetEventRecorderFor("krakend-operator"),
-		SyncInterval:  time.Millisecond * 100,
 		KrakendChart:  chart,
 		NetpolEnabled: true,
 	}).SetupWithManager(k8sManager)
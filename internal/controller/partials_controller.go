@@ -0,0 +1,435 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/krakend"
+	"github.com/nais/krakend/internal/metrics"
+	"github.com/nais/krakend/internal/render"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// errPartialsTooLarge is returned when the endpoints do not fit in the partials ConfigMaps
+var errPartialsTooLarge = errors.New("partials too large")
+
+// PartialsShardLabel is set on the shards of the partials ConfigMap to the name of the Krakend
+const PartialsShardLabel = "krakend.nais.io/partials-of"
+
+// PartialsReconciler renders the endpoints of all ApiEndpoints targeting a Krakend into the partials ConfigMap of the Krakend,
+// or into a partial file per ApiEndpoints spread across the shards of the partials ConfigMap when spec.partials.shards is set.
+// It is the only writer of the partials ConfigMaps, and as requests are keyed by Krakend, changes to several
+// ApiEndpoints at once are coalesced into a single update of the ConfigMaps.
+type PartialsReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// AuthProviders is the catalogue of auth providers available to the ApiEndpoints of all Krakends
+	AuthProviders krakend.AuthProviderCatalogue
+}
+
+func (r *PartialsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log.WithFields(log.Fields{
+		"krakend_name":      req.Name,
+		"krakend_namespace": req.Namespace,
+	}).Debugf("Reconciling partials")
+
+	k := &krakendv1.Krakend{}
+	err := r.Get(ctx, req.NamespacedName, k)
+	if apierrors.IsNotFound(err) {
+		metrics.DeleteKrakend(req.Namespace, req.Name)
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if k.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+
+	size, rendered, err := r.updateKrakendConfigMap(ctx, k)
+	if err != nil {
+		reason := krakendv1.ReasonResourcesFailed
+		if errors.Is(err, errPartialsTooLarge) {
+			reason = krakendv1.ReasonPartialsTooLarge
+		}
+		metrics.ReconcileFailures.WithLabelValues("partials", reason).Inc()
+		r.Recorder.Eventf(k, "Warning", "UpdatePartials", "Unable to update partials ConfigMap for %q: %v", k.Name, err)
+		r.updateStatusCondition(ctx, k, condition(krakendv1.ConditionPartialsReady, metav1.ConditionFalse, reason, err.Error()))
+		for _, a := range rendered {
+			r.updateApiEndpointsCondition(ctx, a.endpoints, condition(krakendv1.ConditionConfigRendered, metav1.ConditionFalse, reason, err.Error()))
+		}
+		return ctrl.Result{}, err
+	}
+	for _, a := range rendered {
+		c := condition(krakendv1.ConditionConfigRendered, metav1.ConditionTrue, krakendv1.ReasonRendered, "")
+		if a.err != nil {
+			c = condition(krakendv1.ConditionConfigRendered, metav1.ConditionFalse, krakendv1.ReasonRenderFailed, a.err.Error())
+		}
+		r.updateApiEndpointsCondition(ctx, a.endpoints, c)
+	}
+
+	// the limit applies to each ConfigMap, sharded partials are spread across all shards
+	limit := render.PartialsSizeLimit * max(1, k.Spec.Partials.Shards)
+	warning := float64(limit) * render.PartialsSizeWarningRatio
+	metrics.PartialsCapacity.WithLabelValues(k.Namespace, k.Name).Set(float64(limit))
+	metrics.PartialsWarning.WithLabelValues(k.Namespace, k.Name).Set(warning)
+	c := condition(krakendv1.ConditionPartialsReady, metav1.ConditionTrue, krakendv1.ReasonRendered, "")
+	if float64(size) > warning {
+		msg := fmt.Sprintf("partials use %d of %d bytes, add shards with spec.partials.shards before the limit is reached", size, limit)
+		r.Recorder.Event(k, "Warning", krakendv1.ReasonPartialsNearLimit, msg)
+		c = condition(krakendv1.ConditionPartialsReady, metav1.ConditionTrue, krakendv1.ReasonPartialsNearLimit, msg)
+	}
+	r.updateStatusCondition(ctx, k, c)
+	return ctrl.Result{}, nil
+}
+
+// updateStatusCondition sets the condition on the status of the Krakend, the status is otherwise owned by the
+// KrakendReconciler, so the Krakend is read again to only change the condition
+func (r *PartialsReconciler) updateStatusCondition(ctx context.Context, k *krakendv1.Krakend, c metav1.Condition) {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &krakendv1.Krakend{}
+		if err := r.Get(ctx, k.NamespacedName(), latest); err != nil {
+			return err
+		}
+		if !setConditions(&latest.Status.Conditions, latest.Generation, c) {
+			return nil
+		}
+		return r.Status().Update(ctx, latest)
+	})
+	if err != nil {
+		r.Recorder.Eventf(k, "Warning", "UpdateStatus", "Unable to update status for %q: %v", k.Name, err)
+	}
+}
+
+// updateApiEndpointsCondition sets the condition on the status of the ApiEndpoints, observed at the generation that was
+// rendered, the status is otherwise owned by the ApiEndpointsReconciler
+func (r *PartialsReconciler) updateApiEndpointsCondition(ctx context.Context, a *krakendv1.ApiEndpoints, c metav1.Condition) {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &krakendv1.ApiEndpoints{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(a), latest); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if !setConditions(&latest.Status.Conditions, a.Generation, c) {
+			return nil
+		}
+		return r.Status().Update(ctx, latest)
+	})
+	if err != nil {
+		log.Errorf("updating status conditions for ApiEndpoints '%s': %v", a.Name, err)
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PartialsReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("partials").
+		For(&krakendv1.Krakend{}).
+		Owns(&corev1.ConfigMap{}).
+		Watches(&krakendv1.ApiEndpoints{}, apiEndpointsHandler).
+		Complete(r)
+}
+
+// apiEndpointsHandler enqueues the Krakend of changed ApiEndpoints, updates enqueue the Krakends of both the old and
+// the new object, so the endpoints are removed from the previous Krakend when spec.krakend changes
+var apiEndpointsHandler = handler.EnqueueRequestsFromMapFunc(krakendForApiEndpoints)
+
+func krakendForApiEndpoints(_ context.Context, obj client.Object) []reconcile.Request {
+	a, ok := obj.(*krakendv1.ApiEndpoints)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{
+		{
+			NamespacedName: types.NamespacedName{
+				Name:      a.KrakendName(),
+				Namespace: a.Namespace,
+			},
+		},
+	}
+}
+
+// updateKrakendConfigMap renders the endpoints of the ApiEndpoints targeting the Krakend into the partials ConfigMaps,
+// and returns the size of the partials with the result of rendering each ApiEndpoints
+func (r *PartialsReconciler) updateKrakendConfigMap(ctx context.Context, k *krakendv1.Krakend) (int, []renderResult, error) {
+	cmName := render.PartialsName(k)
+	log.Debugf("updating ConfigMap '%s' for Krakend '%s'", cmName, k.Name)
+
+	list := &krakendv1.ApiEndpointsList{}
+	if err := r.List(ctx, list, client.InNamespace(k.Namespace)); err != nil {
+		return 0, nil, fmt.Errorf("list all ApiEndpoints: %w", err)
+	}
+	items := apiEndpointsForKrakend(k, list.Items)
+
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: cmName, Namespace: k.Namespace}, cm); err != nil {
+		return 0, nil, fmt.Errorf("get ConfigMap '%s': %w", cmName, err)
+	}
+	shards, err := r.listShards(ctx, k)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	files, endpoints, rendered := r.renderFiles(k, items, previousFiles(cm, shards))
+	metrics.ApiEndpoints.WithLabelValues(k.Namespace, k.Name).Set(float64(len(items)))
+	metrics.Endpoints.WithLabelValues(k.Namespace, k.Name).Set(float64(endpoints))
+
+	indexed, err := r.configReadsIndex(ctx, k)
+	if err != nil {
+		return 0, rendered, err
+	}
+
+	var size int
+	data := map[string]string{}
+	if k.Spec.Partials.Shards > 0 {
+		if size, err = r.updateShards(ctx, k, files, shards); err != nil {
+			return 0, rendered, err
+		}
+	} else {
+		for name, content := range files {
+			data[name] = content
+		}
+	}
+	index, err := render.Index(files)
+	if err != nil {
+		return 0, rendered, err
+	}
+	data[render.EndpointsIndex] = index
+
+	// the index is written after the shards, so KrakenD never includes a partial file missing from the shards
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm := &corev1.ConfigMap{}
+		err := r.Get(ctx, types.NamespacedName{
+			Name:      cmName,
+			Namespace: k.Namespace,
+		}, cm)
+		if err != nil {
+			return fmt.Errorf("get ConfigMap '%s': %w", cmName, err)
+		}
+
+		key := KrakendConfigMapKey
+		if cm.Data[key] == "" {
+			return fmt.Errorf("%s not found in ConfigMap with name %s", key, cmName)
+		}
+
+		updated := make(map[string]string, len(cm.Data))
+		for key, value := range cm.Data {
+			if key != render.EndpointsIndex && !render.IsEndpointsFile(key) {
+				updated[key] = value
+			}
+		}
+		for key, value := range data {
+			updated[key] = value
+		}
+		// the endpoints of the chart are kept until the config reads the index, so KrakenD keeps serving them meanwhile
+		if indexed {
+			updated[key] = "[]"
+		}
+
+		total := render.DataSize(updated)
+		if total > render.PartialsSizeLimit {
+			return fmt.Errorf("%w: ConfigMap '%s' would be %d bytes, more than the limit of %d bytes, split the endpoints across ConfigMaps with spec.partials.shards", errPartialsTooLarge, cmName, total, render.PartialsSizeLimit)
+		}
+		if k.Spec.Partials.Shards == 0 {
+			size = total
+		}
+
+		if reflect.DeepEqual(cm.Data, updated) {
+			log.Debugf("ConfigMap '%s' is up to date", cmName)
+			return nil
+		}
+
+		cm.Data = updated
+		if err := r.Update(ctx, cm); err != nil {
+			return fmt.Errorf("update ConfigMap '%s': %w", cmName, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, rendered, err
+	}
+	metrics.PartialsSize.WithLabelValues(k.Namespace, k.Name).Set(float64(size))
+
+	if err := r.pruneShards(ctx, k, shards); err != nil {
+		return 0, rendered, err
+	}
+	return size, rendered, nil
+}
+
+// renderResult is the result of rendering the endpoints of an ApiEndpoints, err is nil if they were rendered
+type renderResult struct {
+	endpoints *krakendv1.ApiEndpoints
+	err       error
+}
+
+// renderFiles renders a partial file per ApiEndpoints, and returns the files with the number of endpoints in them and
+// the result of rendering each ApiEndpoints. An ApiEndpoints which fails to render keeps its previous file, so it does
+// not block the other ApiEndpoints.
+func (r *PartialsReconciler) renderFiles(k *krakendv1.Krakend, items []krakendv1.ApiEndpoints, previous map[string]string) (map[string]string, int, []renderResult) {
+	files := make(map[string]string)
+	endpoints := 0
+	results := make([]renderResult, 0, len(items))
+	for _, a := range items {
+		name := render.EndpointsFile(&a)
+		content, n, err := render.EndpointsFileContent(k, r.AuthProviders, a)
+		results = append(results, renderResult{endpoints: &a, err: err})
+		if err == nil {
+			files[name] = content
+			endpoints += n
+			continue
+		}
+
+		content, ok := previous[name]
+		if !ok {
+			log.Warnf("unable to render ApiEndpoints %s/%s, leaving it out of Krakend %q: %v", a.Namespace, a.Name, k.Name, err)
+			r.Recorder.Eventf(&a, "Warning", krakendv1.ReasonRenderFailed, "Unable to render endpoints for Krakend %q, they are not added: %v", k.Name, err)
+			continue
+		}
+		log.Warnf("unable to render ApiEndpoints %s/%s, keeping the endpoints rendered last in Krakend %q: %v", a.Namespace, a.Name, k.Name, err)
+		r.Recorder.Eventf(&a, "Warning", krakendv1.ReasonRenderFailed, "Unable to render endpoints for Krakend %q, the endpoints rendered last are kept: %v", k.Name, err)
+		files[name] = content
+		if partials, err := krakend.ParsePartials([]byte(content)); err == nil {
+			endpoints += len(partials.Endpoints)
+		}
+	}
+	return files, endpoints, results
+}
+
+// previousFiles returns the partial files of the ApiEndpoints in the partials ConfigMap and its shards
+func previousFiles(cm *corev1.ConfigMap, shards map[string]*corev1.ConfigMap) map[string]string {
+	files := make(map[string]string)
+	for _, c := range append([]*corev1.ConfigMap{cm}, slices.Collect(maps.Values(shards))...) {
+		for name, content := range c.Data {
+			if render.IsEndpointsFile(name) {
+				files[name] = content
+			}
+		}
+	}
+	return files
+}
+
+// configReadsIndex returns true if the config of the Krakend reads the endpoints from the index, as changed by the
+// KrakendReconciler, instead of the endpoints partial of the chart
+func (r *PartialsReconciler) configReadsIndex(ctx context.Context, k *krakendv1.Krakend) (bool, error) {
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: render.ConfigName(k), Namespace: k.Namespace}, cm)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get ConfigMap '%s': %w", render.ConfigName(k), err)
+	}
+	for _, config := range cm.Data {
+		if strings.Contains(config, render.EndpointsIndex) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// listShards returns the shards of the partials ConfigMap of the Krakend by name
+func (r *PartialsReconciler) listShards(ctx context.Context, k *krakendv1.Krakend) (map[string]*corev1.ConfigMap, error) {
+	list := &corev1.ConfigMapList{}
+	if err := r.List(ctx, list, client.InNamespace(k.Namespace), client.MatchingLabels{PartialsShardLabel: k.Name}); err != nil {
+		return nil, fmt.Errorf("list partials shards: %w", err)
+	}
+	shards := make(map[string]*corev1.ConfigMap)
+	for i := range list.Items {
+		shards[list.Items[i].Name] = &list.Items[i]
+	}
+	return shards, nil
+}
+
+// updateShards creates or updates the shards with the partial files, and returns the total size of the shards
+func (r *PartialsReconciler) updateShards(ctx context.Context, k *krakendv1.Krakend, files map[string]string, existing map[string]*corev1.ConfigMap) (int, error) {
+	current := make(map[string]int)
+	for i := 0; i < k.Spec.Partials.Shards; i++ {
+		if cm, ok := existing[render.ShardName(k, i+1)]; ok {
+			for name := range cm.Data {
+				current[name] = i
+			}
+		}
+	}
+	data, err := render.Shard(files, k.Spec.Partials.Shards, current)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errPartialsTooLarge, err)
+	}
+
+	size := 0
+	for i, d := range data {
+		size += render.DataSize(d)
+		name := render.ShardName(k, i+1)
+		cm, ok := existing[name]
+		if ok && reflect.DeepEqual(cm.Data, d) {
+			continue
+		}
+		if !ok {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            name,
+					Namespace:       k.Namespace,
+					Labels:          map[string]string{PartialsShardLabel: k.Name},
+					Annotations:     map[string]string{"reloader.stakater.com/match": "true"},
+					OwnerReferences: []metav1.OwnerReference{controllerRef(k)},
+				},
+				Data: d,
+			}
+			if err := r.Create(ctx, cm); err != nil {
+				return 0, fmt.Errorf("create ConfigMap '%s': %w", name, err)
+			}
+			continue
+		}
+		cm = cm.DeepCopy()
+		cm.Data = d
+		if err := r.Update(ctx, cm); err != nil {
+			return 0, fmt.Errorf("update ConfigMap '%s': %w", name, err)
+		}
+	}
+	return size, nil
+}
+
+// pruneShards deletes the shards beyond the number of shards in the spec of the Krakend
+func (r *PartialsReconciler) pruneShards(ctx context.Context, k *krakendv1.Krakend, existing map[string]*corev1.ConfigMap) error {
+	keep := make(map[string]bool)
+	for i := 0; i < k.Spec.Partials.Shards; i++ {
+		keep[render.ShardName(k, i+1)] = true
+	}
+	for name, cm := range existing {
+		if keep[name] {
+			continue
+		}
+		if err := client.IgnoreNotFound(r.Delete(ctx, cm)); err != nil {
+			return fmt.Errorf("delete ConfigMap '%s': %w", name, err)
+		}
+		log.Infof("deleted partials shard %s of krakend %q", name, k.Name)
+	}
+	return nil
+}
+
+// apiEndpointsForKrakend returns the ApiEndpoints targeting the Krakend that are not being deleted
+func apiEndpointsForKrakend(k *krakendv1.Krakend, list []krakendv1.ApiEndpoints) []krakendv1.ApiEndpoints {
+	filtered := make([]krakendv1.ApiEndpoints, 0)
+	for _, e := range list {
+		if e.GetDeletionTimestamp() == nil && e.Namespace == k.Namespace && e.KrakendName() == k.Name {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/krakend"
+	"github.com/nais/krakend/internal/metrics"
+	"github.com/nais/krakend/internal/render"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"strings"
+	"testing"
+)
+
+func TestApiEndpointsForKrakend(t *testing.T) {
+	k := &krakendv1.Krakend{ObjectMeta: metav1.ObjectMeta{Name: "ns1", Namespace: "ns1"}}
+	now := metav1.Now()
+
+	list := []krakendv1.ApiEndpoints{
+		{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "ns1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "explicit", Namespace: "ns1"}, Spec: krakendv1.ApiEndpointsSpec{Krakend: "ns1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "ns1"}, Spec: krakendv1.ApiEndpointsSpec{Krakend: "other"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: "ns1", DeletionTimestamp: &now}},
+	}
+
+	filtered := apiEndpointsForKrakend(k, list)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, "default", filtered[0].Name)
+	assert.Equal(t, "explicit", filtered[1].Name)
+}
+
+func TestApiEndpointsHandlerEnqueuesPreviousKrakend(t *testing.T) {
+	old := &krakendv1.ApiEndpoints{ObjectMeta: metav1.ObjectMeta{Name: "app1", Namespace: "ns1"}, Spec: krakendv1.ApiEndpointsSpec{Krakend: "a"}}
+	updated := old.DeepCopy()
+	updated.Spec.Krakend = "b"
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	apiEndpointsHandler.Update(context.Background(), event.UpdateEvent{ObjectOld: old, ObjectNew: updated}, q)
+
+	enqueued := make([]string, 0)
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		enqueued = append(enqueued, item.(reconcile.Request).String())
+		q.Done(item)
+	}
+	assert.ElementsMatch(t, []string{"ns1/a", "ns1/b"}, enqueued)
+}
+
+func TestUpdateKrakendConfigMap(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, krakendv1.AddToScheme(scheme))
+	assert.NoError(t, corev1.AddToScheme(scheme))
+
+	k := &krakendv1.Krakend{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1", Namespace: "ns1"},
+		Spec: krakendv1.KrakendSpec{
+			AuthProviders: []krakendv1.AuthProvider{{Name: "maskinporten"}},
+		},
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1-krakend-partials", Namespace: "ns1"},
+		Data:       map[string]string{KrakendConfigMapKey: `[{"endpoint":"/chart"}]`},
+	}
+	config := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1-krakend-config", Namespace: "ns1"},
+		Data:       map[string]string{"krakend.tmpl": `{"endpoints": {{ include "endpoints.tmpl" }}}`},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(k, cm, config, app("app1", 1), app("app2", 1)).WithStatusSubresource(k).Build()
+	r := &PartialsReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "ns1", Namespace: "ns1"}}
+
+	_, err := r.Reconcile(context.Background(), req)
+	assert.NoError(t, err)
+
+	updated := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(cm), updated))
+	assert.Equal(t, `["apiendpoints_app1.json","apiendpoints_app2.json"]`, updated.Data[render.EndpointsIndex])
+	app1, err := krakend.ParsePartials([]byte(updated.Data["apiendpoints_app1.json"]))
+	assert.NoError(t, err)
+	assert.Len(t, app1.Endpoints, 1)
+	// the endpoints of the chart are kept until the config reads the index
+	assert.Equal(t, `[{"endpoint":"/chart"}]`, updated.Data[KrakendConfigMapKey])
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.ApiEndpoints.WithLabelValues("ns1", "ns1")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.Endpoints.WithLabelValues("ns1", "ns1")))
+	assert.Equal(t, float64(render.DataSize(updated.Data)), testutil.ToFloat64(metrics.PartialsSize.WithLabelValues("ns1", "ns1")))
+	assertPartialsCondition(t, c, metav1.ConditionTrue, krakendv1.ReasonRendered)
+
+	// reconciling again without changes should leave the ConfigMap untouched
+	_, err = r.Reconcile(context.Background(), req)
+	assert.NoError(t, err)
+	unchanged := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(cm), unchanged))
+	assert.Equal(t, updated.ResourceVersion, unchanged.ResourceVersion)
+
+	config.Data["krakend.tmpl"], err = render.IndexedConfig(config.Data["krakend.tmpl"])
+	assert.NoError(t, err)
+	assert.NoError(t, c.Update(context.Background(), config))
+	_, err = r.Reconcile(context.Background(), req)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(cm), updated))
+	assert.Equal(t, "[]", updated.Data[KrakendConfigMapKey])
+
+	// the series of a deleted Krakend are removed
+	assert.NoError(t, c.Delete(context.Background(), k))
+	_, err = r.Reconcile(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.Endpoints))
+}
+
+func TestUpdateKrakendConfigMapIsolatesFailures(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, krakendv1.AddToScheme(scheme))
+	assert.NoError(t, corev1.AddToScheme(scheme))
+
+	k := &krakendv1.Krakend{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1", Namespace: "ns1"},
+		Spec: krakendv1.KrakendSpec{
+			AuthProviders: []krakendv1.AuthProvider{{Name: "maskinporten"}},
+		},
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1-krakend-partials", Namespace: "ns1"},
+		Data:       map[string]string{KrakendConfigMapKey: "[]"},
+	}
+	broken := app("broken", 1)
+	broken.Spec.Auth.Name = "azure"
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(k, cm, app("app1", 1), app("app2", 2), broken).WithStatusSubresource(k, &krakendv1.ApiEndpoints{}).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &PartialsReconciler{Client: c, Scheme: scheme, Recorder: recorder}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "ns1", Namespace: "ns1"}}
+
+	// an ApiEndpoints which has never rendered is left out, the others are rendered
+	_, err := r.Reconcile(context.Background(), req)
+	assert.NoError(t, err)
+	updated := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(cm), updated))
+	assert.Equal(t, `["apiendpoints_app1.json","apiendpoints_app2.json"]`, updated.Data[render.EndpointsIndex])
+	assert.Contains(t, <-recorder.Events, "Warning RenderFailed Unable to render endpoints for Krakend \"ns1\", they are not added")
+	assertPartialsCondition(t, c, metav1.ConditionTrue, krakendv1.ReasonRendered)
+	assertConfigRendered(t, c, "app1", metav1.ConditionTrue, krakendv1.ReasonRendered)
+	assertConfigRendered(t, c, "broken", metav1.ConditionFalse, krakendv1.ReasonRenderFailed)
+
+	// an ApiEndpoints which fails after it has rendered keeps the endpoints rendered last
+	app1 := &krakendv1.ApiEndpoints{}
+	assert.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: "app1", Namespace: "ns1"}, app1))
+	previous := updated.Data["apiendpoints_app1.json"]
+	app1.Spec.Auth.Name = "azure"
+	app1.Spec.Endpoints = append(app1.Spec.Endpoints, krakendv1.Endpoint{Path: "/app1/new", Method: "GET", BackendHost: "http://app1"})
+	assert.NoError(t, c.Update(context.Background(), app1))
+	app2 := &krakendv1.ApiEndpoints{}
+	assert.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: "app2", Namespace: "ns1"}, app2))
+	app2.Spec.Endpoints = app2.Spec.Endpoints[:1]
+	assert.NoError(t, c.Update(context.Background(), app2))
+
+	_, err = r.Reconcile(context.Background(), req)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(cm), updated))
+	assert.Equal(t, previous, updated.Data["apiendpoints_app1.json"])
+	partials, err := krakend.ParsePartials([]byte(updated.Data["apiendpoints_app2.json"]))
+	assert.NoError(t, err)
+	assert.Len(t, partials.Endpoints, 1)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.Endpoints.WithLabelValues("ns1", "ns1")))
+	assert.Contains(t, <-recorder.Events, "the endpoints rendered last are kept")
+	assertConfigRendered(t, c, "app1", metav1.ConditionFalse, krakendv1.ReasonRenderFailed)
+	assertConfigRendered(t, c, "app2", metav1.ConditionTrue, krakendv1.ReasonRendered)
+}
+
+func TestUpdateKrakendConfigMapSharded(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, krakendv1.AddToScheme(scheme))
+	assert.NoError(t, corev1.AddToScheme(scheme))
+
+	k := &krakendv1.Krakend{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1", Namespace: "ns1"},
+		Spec: krakendv1.KrakendSpec{
+			AuthProviders: []krakendv1.AuthProvider{{Name: "maskinporten"}},
+			Partials:      krakendv1.Partials{Shards: 2},
+		},
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1-krakend-partials", Namespace: "ns1"},
+		Data:       map[string]string{KrakendConfigMapKey: "[]"},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(k, cm, app("app1", 1), app("app2", 2)).WithStatusSubresource(k, &krakendv1.ApiEndpoints{}).Build()
+	r := &PartialsReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "ns1", Namespace: "ns1"}}
+
+	_, err := r.Reconcile(context.Background(), req)
+	assert.NoError(t, err)
+
+	updated := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(cm), updated))
+	assert.Equal(t, `["apiendpoints_app1.json","apiendpoints_app2.json"]`, updated.Data[render.EndpointsIndex])
+	assert.NotContains(t, updated.Data, "apiendpoints_app1.json")
+
+	shard := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: "ns1-krakend-partials-1", Namespace: "ns1"}, shard))
+	assert.Equal(t, "ns1", shard.Labels[PartialsShardLabel])
+	app2, err := krakend.ParsePartials([]byte(shard.Data["apiendpoints_app2.json"]))
+	assert.NoError(t, err)
+	assert.Len(t, app2.Endpoints, 2)
+	assert.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: "ns1-krakend-partials-2", Namespace: "ns1"}, shard))
+	assert.Empty(t, shard.Data)
+	assert.Equal(t, float64(2*render.PartialsSizeLimit), testutil.ToFloat64(metrics.PartialsCapacity.WithLabelValues("ns1", "ns1")))
+	assert.Equal(t, 2*render.PartialsSizeLimit*render.PartialsSizeWarningRatio, testutil.ToFloat64(metrics.PartialsWarning.WithLabelValues("ns1", "ns1")))
+	assertPartialsCondition(t, c, metav1.ConditionTrue, krakendv1.ReasonRendered)
+
+	// an ApiEndpoints which does not fit in any shard fails the update, and the previous partials are kept
+	large := app("app3", 1)
+	large.Spec.Endpoints[0].BackendHost = "http://" + strings.Repeat("a", render.PartialsSizeLimit)
+	assert.NoError(t, c.Create(context.Background(), large))
+	_, err = r.Reconcile(context.Background(), req)
+	assert.ErrorIs(t, err, errPartialsTooLarge)
+	assertPartialsCondition(t, c, metav1.ConditionFalse, krakendv1.ReasonPartialsTooLarge)
+	// the endpoints of the ApiEndpoints are not stored when the partials cannot be updated
+	assertConfigRendered(t, c, "app1", metav1.ConditionFalse, krakendv1.ReasonPartialsTooLarge)
+	unchanged := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(cm), unchanged))
+	assert.Equal(t, updated.ResourceVersion, unchanged.ResourceVersion)
+	assert.NoError(t, c.Delete(context.Background(), large))
+
+	// without shards the files are written to the partials ConfigMap, and the shards are deleted
+	latest := &krakendv1.Krakend{}
+	assert.NoError(t, c.Get(context.Background(), req.NamespacedName, latest))
+	latest.Spec.Partials.Shards = 0
+	assert.NoError(t, c.Update(context.Background(), latest))
+	_, err = r.Reconcile(context.Background(), req)
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(cm), updated))
+	assert.Equal(t, `["apiendpoints_app1.json","apiendpoints_app2.json"]`, updated.Data[render.EndpointsIndex])
+	assert.Contains(t, updated.Data, "apiendpoints_app2.json")
+	shards := &corev1.ConfigMapList{}
+	assert.NoError(t, c.List(context.Background(), shards, client.MatchingLabels{PartialsShardLabel: "ns1"}))
+	assert.Empty(t, shards.Items)
+}
+
+// app returns an ApiEndpoints in ns1 with the given number of endpoints
+func app(name string, endpoints int) *krakendv1.ApiEndpoints {
+	a := &krakendv1.ApiEndpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns1"},
+		Spec: krakendv1.ApiEndpointsSpec{
+			Auth: krakendv1.Auth{Name: "maskinporten"},
+		},
+	}
+	for i := 0; i < endpoints; i++ {
+		a.Spec.Endpoints = append(a.Spec.Endpoints, krakendv1.Endpoint{Path: fmt.Sprintf("/%s/%d", name, i), Method: "GET", BackendHost: "http://" + name})
+	}
+	return a
+}
+
+func assertPartialsCondition(t *testing.T, c client.Client, status metav1.ConditionStatus, reason string) {
+	t.Helper()
+	k := &krakendv1.Krakend{}
+	assert.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: "ns1", Namespace: "ns1"}, k))
+	cond := meta.FindStatusCondition(k.Status.Conditions, krakendv1.ConditionPartialsReady)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, status, cond.Status)
+		assert.Equal(t, reason, cond.Reason)
+	}
+}
+
+func assertConfigRendered(t *testing.T, c client.Client, name string, status metav1.ConditionStatus, reason string) {
+	t.Helper()
+	a := &krakendv1.ApiEndpoints{}
+	assert.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "ns1"}, a))
+	cond := meta.FindStatusCondition(a.Status.Conditions, krakendv1.ConditionConfigRendered)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, status, cond.Status)
+		assert.Equal(t, reason, cond.Reason)
+		assert.Equal(t, a.Generation, cond.ObservedGeneration)
+	}
+}
@@ -0,0 +1,148 @@
+package krakend
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	v1 "github.com/nais/krakend/api/v1"
+)
+
+const (
+	OperatorEquals    = "=="
+	OperatorNotEquals = "!="
+	OperatorIn        = "in"
+	OperatorNotIn     = "not in"
+)
+
+var claimRulePattern = regexp.MustCompile(`^\s*([A-Za-z_][\w-]*(?:\.[A-Za-z_][\w-]*)*)\s*(==|!=|not\s+in|in)\s*(.*?)\s*$`)
+
+// ClaimRule is a rule on the value of a claim of the JWT, e.g. consumer.ID in ["0192:889640782"]
+type ClaimRule struct {
+	// Claim is the path to the claim, with nested claims separated with dots
+	Claim    string
+	Operator string
+	Values   []string
+}
+
+// ParseClaimRule parses a rule in the form <claim> == <value>, <claim> != <value>, <claim> in [<values>] or
+// <claim> not in [<values>]. Values are separated with commas, and can be quoted with " or '.
+func ParseClaimRule(rule string) (*ClaimRule, error) {
+	m := claimRulePattern.FindStringSubmatch(rule)
+	if m == nil {
+		return nil, fmt.Errorf("must be in the form <claim> == <value>, <claim> != <value>, <claim> in [<values>] or <claim> not in [<values>]")
+	}
+	r := &ClaimRule{
+		Claim:    m[1],
+		Operator: strings.Join(strings.Fields(m[2]), " "),
+	}
+	if m[3] == "" {
+		return nil, fmt.Errorf("missing value after %s", r.Operator)
+	}
+
+	switch r.Operator {
+	case OperatorIn, OperatorNotIn:
+		if !strings.HasPrefix(m[3], "[") || !strings.HasSuffix(m[3], "]") {
+			return nil, fmt.Errorf("the values of %s must be a list in brackets, e.g. [\"a\", \"b\"]", r.Operator)
+		}
+		values, err := parseValues(m[3][1 : len(m[3])-1])
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("the list of values of %s is empty", r.Operator)
+		}
+		r.Values = values
+	default:
+		if strings.HasPrefix(m[3], "[") {
+			return nil, fmt.Errorf("%s compares with a single value, use in or not in for a list", r.Operator)
+		}
+		values, err := parseValues(m[3])
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != 1 {
+			return nil, fmt.Errorf("%s compares with a single value, quote values with commas", r.Operator)
+		}
+		r.Values = values
+	}
+	return r, nil
+}
+
+// parseValues splits a list of values separated with commas, values are unquoted if quoted with " or '
+func parseValues(s string) ([]string, error) {
+	values := make([]string, 0)
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		var value string
+		if q := rest[0]; q == '"' || q == '\'' {
+			end := strings.IndexByte(rest[1:], q)
+			if end < 0 {
+				return nil, fmt.Errorf("missing closing quote in %s", rest)
+			}
+			value = rest[1 : end+1]
+			rest = strings.TrimSpace(rest[end+2:])
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value = strings.TrimSpace(rest[:end])
+			rest = rest[end:]
+		}
+		if value == "" {
+			return nil, fmt.Errorf("empty value in %s", s)
+		}
+		values = append(values, value)
+
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return nil, fmt.Errorf("values must be separated with commas in %s", s)
+		}
+		rest = strings.TrimSpace(rest[1:])
+		if rest == "" {
+			return nil, fmt.Errorf("empty value in %s", s)
+		}
+	}
+	return values, nil
+}
+
+// Expression returns the rule as a CEL expression on the claims of the JWT, as evaluated by KrakenD
+func (r *ClaimRule) Expression() string {
+	claim := "JWT"
+	for _, c := range strings.Split(r.Claim, ".") {
+		claim += "[" + strconv.Quote(c) + "]"
+	}
+	values := make([]string, 0, len(r.Values))
+	for _, v := range r.Values {
+		values = append(values, strconv.Quote(v))
+	}
+
+	switch r.Operator {
+	case OperatorIn:
+		return fmt.Sprintf("%s in [%s]", claim, strings.Join(values, ", "))
+	case OperatorNotIn:
+		return fmt.Sprintf("!(%s in [%s])", claim, strings.Join(values, ", "))
+	default:
+		return fmt.Sprintf("%s %s %s", claim, r.Operator, values[0])
+	}
+}
+
+// claimChecks returns the CEL checks of the claim rules of the auth
+func claimChecks(auth *v1.Auth) ([]*CelCheck, error) {
+	if len(auth.RequireClaims) == 0 {
+		return nil, nil
+	}
+	checks := make([]*CelCheck, 0, len(auth.RequireClaims))
+	for _, rule := range auth.RequireClaims {
+		r, err := ParseClaimRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("claim rule '%s': %w", rule, err)
+		}
+		checks = append(checks, &CelCheck{CheckExpr: r.Expression()})
+	}
+	return checks, nil
+}
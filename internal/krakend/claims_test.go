@@ -0,0 +1,58 @@
+package krakend
+
+import (
+	"testing"
+
+	v1 "github.com/nais/krakend/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClaimRule(t *testing.T) {
+	for rule, expr := range map[string]string{
+		`consumer.ID in ["0192:889640782", "0192:974761076"]`: `JWT["consumer"]["ID"] in ["0192:889640782", "0192:974761076"]`,
+		`consumer.ID in [0192:889640782]`:                     `JWT["consumer"]["ID"] in ["0192:889640782"]`,
+		`client_id == 'app1'`:                                 `JWT["client_id"] == "app1"`,
+		`iss==https://test.maskinporten.no/`:                  `JWT["iss"] == "https://test.maskinporten.no/"`,
+		`azp_name != "dev:team1:app, with comma"`:             `JWT["azp_name"] != "dev:team1:app, with comma"`,
+		`consumer.ID not  in ["0192:889640782"]`:              `!(JWT["consumer"]["ID"] in ["0192:889640782"])`,
+	} {
+		r, err := ParseClaimRule(rule)
+		if assert.NoError(t, err, rule) {
+			assert.Equal(t, expr, r.Expression(), rule)
+		}
+	}
+
+	for rule, msg := range map[string]string{
+		`consumer.ID`:             "must be in the form",
+		`consumer.ID > 1`:         "must be in the form",
+		`.ID == 1`:                "must be in the form",
+		`client_id ==`:            "missing value",
+		`consumer.ID in "0192:1"`: "must be a list in brackets",
+		`consumer.ID in []`:       "is empty",
+		`consumer.ID in [a,,b]`:   "empty value",
+		`consumer.ID in [a,]`:     "empty value",
+		`consumer.ID in ["a" b]`:  "separated with commas",
+		`consumer.ID in ["a]`:     "missing closing quote",
+		`client_id == [app1]`:     "use in or not in",
+		`client_id == app1, app2`: "single value",
+	} {
+		_, err := ParseClaimRule(rule)
+		assert.ErrorContains(t, err, msg, rule)
+	}
+}
+
+func TestClaimChecks(t *testing.T) {
+	checks, err := claimChecks(&v1.Auth{})
+	assert.NoError(t, err)
+	assert.Nil(t, checks)
+
+	checks, err = claimChecks(&v1.Auth{RequireClaims: []string{"client_id == app1", "consumer.ID in [0192:889640782]"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []*CelCheck{
+		{CheckExpr: `JWT["client_id"] == "app1"`},
+		{CheckExpr: `JWT["consumer"]["ID"] in ["0192:889640782"]`},
+	}, checks)
+
+	_, err = claimChecks(&v1.Auth{RequireClaims: []string{"client_id"}})
+	assert.ErrorContains(t, err, "claim rule 'client_id'")
+}
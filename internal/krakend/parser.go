@@ -2,7 +2,11 @@ package krakend
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+
 	v1 "github.com/nais/krakend/api/v1"
 )
 
@@ -21,26 +25,52 @@ type Endpoint struct {
 }
 
 type Backend struct {
-	Method     string   `json:"method"`
-	Host       []string `json:"host"`
-	UrlPattern string   `json:"url_pattern"`
-	Encoding   string   `json:"encoding"`
+	Method      string              `json:"method"`
+	Host        []string            `json:"host"`
+	UrlPattern  string              `json:"url_pattern"`
+	Encoding    string              `json:"encoding"`
+	Group       string              `json:"group,omitempty"`
+	Target      string              `json:"target,omitempty"`
+	Allow       []string            `json:"allow,omitempty"`
+	Deny        []string            `json:"deny,omitempty"`
+	ExtraConfig *BackendExtraConfig `json:"extra_config,omitempty"`
+}
+
+type BackendExtraConfig struct {
+	QosRatelimitProxy *QosRatelimitProxy `json:"qos/ratelimit/proxy,omitempty"`
+	QosCircuitBreaker *QosCircuitBreaker `json:"qos/circuit-breaker,omitempty"`
+	QosHttpCache      *QosHttpCache      `json:"qos/http-cache,omitempty"`
 }
 
 type ExtraConfig struct {
 	AuthValidator      *AuthValidator      `json:"auth/validator,omitempty"`
+	AuthApiKeys        *AuthApiKeys        `json:"auth/api-keys,omitempty"`
 	QosRatelimitRouter *QosRatelimitRouter `json:"qos/ratelimit/router,omitempty"`
+	ValidationCel      []*CelCheck         `json:"validation/cel,omitempty"`
+}
+
+type AuthApiKeys struct {
+	Roles []string `json:"roles"`
+}
+
+type CelCheck struct {
+	CheckExpr string `json:"check_expr"`
 }
 
 type AuthValidator struct {
-	OperationDebug bool     `json:"operation_debug"`
-	Alg            string   `json:"alg"`
-	Cache          bool     `json:"cache"`
-	JwkUrl         string   `json:"jwk_url"`
-	Issuer         string   `json:"issuer"`
-	Audience       []string `json:"audience,omitempty"`
-	Scope          []string `json:"scopes,omitempty"`
-	ScopesKey      string   `json:"scopes_key,omitempty"`
+	OperationDebug   bool       `json:"operation_debug"`
+	Alg              string     `json:"alg"`
+	Cache            bool       `json:"cache"`
+	JwkUrl           string     `json:"jwk_url"`
+	Issuer           string     `json:"issuer"`
+	Audience         []string   `json:"audience,omitempty"`
+	Scope            []string   `json:"scopes,omitempty"`
+	ScopesKey        string     `json:"scopes_key,omitempty"`
+	ScopesMatcher    string     `json:"scopes_matcher,omitempty"`
+	Roles            []string   `json:"roles,omitempty"`
+	RolesKey         string     `json:"roles_key,omitempty"`
+	RolesKeyIsNested bool       `json:"roles_key_is_nested,omitempty"`
+	PropagateClaims  [][]string `json:"propagate_claims,omitempty"`
 }
 
 type QosRatelimitRouter struct {
@@ -53,13 +83,41 @@ type QosRatelimitRouter struct {
 	ClientCapacity int    `json:"client_capacity,omitempty"`
 }
 
+type QosRatelimitProxy struct {
+	MaxRate  int    `json:"max_rate"`
+	Capacity int    `json:"capacity,omitempty"`
+	Every    string `json:"every,omitempty"`
+}
+
+type QosCircuitBreaker struct {
+	Interval        int  `json:"interval"`
+	Timeout         int  `json:"timeout"`
+	MaxErrors       int  `json:"max_errors"`
+	LogStatusChange bool `json:"log_status_change,omitempty"`
+}
+
+type QosHttpCache struct {
+	Shared   bool `json:"shared,omitempty"`
+	MaxItems int  `json:"max_items,omitempty"`
+	MaxSize  int  `json:"max_size,omitempty"`
+}
+
 const DefaultOutputEncoding = "no-op"
+
+// JsonEncoding is used when responses are aggregated or manipulated, as this is not supported with no-op encoding
+const JsonEncoding = "json"
 const DefaultScopesKey = "scope"
+const DefaultRolesKey = "roles"
+
+var ErrAuthProviderNotFound = errors.New("auth provider not found")
 
-func ToKrakendEndpoints(k *v1.Krakend, list []v1.ApiEndpoints) ([]*Endpoint, error) {
+func ToKrakendEndpoints(k *v1.Krakend, catalogue AuthProviderCatalogue, list []v1.ApiEndpoints) ([]*Endpoint, error) {
 	endpoints := make([]*Endpoint, 0)
 	for _, item := range list {
-		parsed, err := parseKrakendEndpointsSpec(k, item.Spec)
+		// defaults are normally set by the mutating webhook, they are applied here as well to render the same configuration without it
+		item := item.DeepCopy()
+		item.Default()
+		parsed, err := parseKrakendEndpointsSpec(k, catalogue, item.Spec)
 		if err != nil {
 			return nil, err
 		}
@@ -68,10 +126,10 @@ func ToKrakendEndpoints(k *v1.Krakend, list []v1.ApiEndpoints) ([]*Endpoint, err
 	return endpoints, nil
 }
 
-func parseKrakendEndpointsSpec(k *v1.Krakend, spec v1.ApiEndpointsSpec) ([]*Endpoint, error) {
+func parseKrakendEndpointsSpec(k *v1.Krakend, catalogue AuthProviderCatalogue, spec v1.ApiEndpointsSpec) ([]*Endpoint, error) {
 	endpoints := make([]*Endpoint, 0)
 
-	auth, err := findAuthProvider(k, &spec.Auth)
+	auth, err := parseAuth(k, catalogue, &spec.Auth)
 	rateLimit := spec.RateLimit
 	if err != nil {
 		return nil, err
@@ -79,32 +137,71 @@ func parseKrakendEndpointsSpec(k *v1.Krakend, spec v1.ApiEndpointsSpec) ([]*Endp
 
 	for _, e := range spec.Endpoints {
 		endpoint := parseEndpoint(e)
-		endpoint.ExtraConfig.AuthValidator = auth
-		endpoint.ExtraConfig.QosRatelimitRouter = parseRateLimit(rateLimit)
+		endpointAuth := auth
+		if e.Auth != nil {
+			endpointAuth, err = parseAuth(k, catalogue, e.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("endpoint '%s': %w", e.Path, err)
+			}
+		}
+		endpointAuth.apply(endpoint)
+		endpoint.ExtraConfig.QosRatelimitRouter = parseRateLimit(endpointRateLimit(rateLimit, e))
+		setBackendExtraConfig(endpoint, parseBackendExtraConfig(spec, e))
 		endpoints = append(endpoints, endpoint)
 	}
 	for _, e := range spec.OpenEndpoints {
 		endpoint := parseEndpoint(e)
 		endpoint.ExtraConfig = &ExtraConfig{}
-		endpoint.ExtraConfig.QosRatelimitRouter = parseRateLimit(rateLimit)
+		endpoint.ExtraConfig.QosRatelimitRouter = parseRateLimit(endpointRateLimit(rateLimit, e))
+		setBackendExtraConfig(endpoint, parseBackendExtraConfig(spec, e))
 		endpoints = append(endpoints, endpoint)
 	}
 	return endpoints, nil
 }
 
-func parseEndpoint(e v1.Endpoint) *Endpoint {
-	backend := []*Backend{
-		{
-			Method:     e.Method,
-			Host:       []string{e.BackendHost},
-			UrlPattern: e.BackendPath,
-			Encoding:   DefaultOutputEncoding,
-		},
+// endpointAuth is the auth of an endpoint, either a JWT validator with its claim checks or API keys
+type endpointAuth struct {
+	validator *AuthValidator
+	checks    []*CelCheck
+	apiKeys   *AuthApiKeys
+}
+
+// parseAuth resolves the auth of ApiEndpoints against the auth providers or the API keys of the Krakend, or the
+// auth providers of the catalogue
+func parseAuth(k *v1.Krakend, catalogue AuthProviderCatalogue, auth *v1.Auth) (*endpointAuth, error) {
+	if auth.ApiKeys != nil {
+		if k.Spec.ApiKeys == nil {
+			return nil, fmt.Errorf("%w: no apiKeys in Krakend '%s'", ErrAuthProviderNotFound, k.Name)
+		}
+		return &endpointAuth{apiKeys: &AuthApiKeys{Roles: auth.ApiKeys.Roles}}, nil
+	}
+	validator, err := findAuthProvider(k, catalogue, auth)
+	if err != nil {
+		return nil, err
 	}
+	checks, err := claimChecks(auth)
+	if err != nil {
+		return nil, err
+	}
+	return &endpointAuth{validator: validator, checks: checks}, nil
+}
+
+// apply sets the auth in the extra config of the endpoint
+func (a *endpointAuth) apply(endpoint *Endpoint) {
+	endpoint.ExtraConfig.AuthValidator = a.validator
+	endpoint.ExtraConfig.ValidationCel = a.checks
+	endpoint.ExtraConfig.AuthApiKeys = a.apiKeys
+	if a.validator != nil {
+		endpoint.InputHeaders = inputHeaders(endpoint.InputHeaders, a.validator)
+	}
+}
+
+func parseEndpoint(e v1.Endpoint) *Endpoint {
+	backend := parseBackends(e)
 	endpoint := &Endpoint{
 		Endpoint:          e.Path,
 		Method:            e.Method,
-		OutputEncoding:    DefaultOutputEncoding,
+		OutputEncoding:    backend[0].Encoding,
 		Backend:           backend,
 		InputQueryStrings: e.QueryParams,
 		InputHeaders:      e.ForwardHeaders,
@@ -116,8 +213,82 @@ func parseEndpoint(e v1.Endpoint) *Endpoint {
 	return endpoint
 }
 
+// inputHeaders returns the headers forwarded to the backends with the headers of the claims propagated by the auth
+// validator added, as KrakenD only forwards the headers listed in the endpoint
+func inputHeaders(headers []string, auth *AuthValidator) []string {
+	if len(auth.PropagateClaims) == 0 || slices.Contains(headers, "*") {
+		return headers
+	}
+	result := append([]string{}, headers...)
+	for _, c := range auth.PropagateClaims {
+		header := c[1]
+		if !slices.ContainsFunc(result, func(h string) bool { return strings.EqualFold(h, header) }) {
+			result = append(result, header)
+		}
+	}
+	return result
+}
+
+func parseBackends(e v1.Endpoint) []*Backend {
+	if len(e.Backends) == 0 {
+		return []*Backend{
+			{
+				Method:     e.Method,
+				Host:       []string{e.BackendHost},
+				UrlPattern: e.BackendPath,
+				Encoding:   DefaultOutputEncoding,
+			},
+		}
+	}
+
+	encoding := DefaultOutputEncoding
+	if needsJsonEncoding(e.Backends) {
+		encoding = JsonEncoding
+	}
+
+	backends := make([]*Backend, 0)
+	for _, b := range e.Backends {
+		method := b.Method
+		if method == "" {
+			method = e.Method
+		}
+		backends = append(backends, &Backend{
+			Method:     method,
+			Host:       b.Hosts,
+			UrlPattern: b.Path,
+			Encoding:   encoding,
+			Group:      b.Group,
+			Target:     b.Target,
+			Allow:      b.Allow,
+			Deny:       b.Deny,
+		})
+	}
+	return backends
+}
+
+// needsJsonEncoding returns true if the backend responses are merged or manipulated, which KrakenD cannot do with no-op encoding
+func needsJsonEncoding(backends []v1.Backend) bool {
+	if len(backends) > 1 {
+		return true
+	}
+	for _, b := range backends {
+		if b.Group != "" || b.Target != "" || len(b.Allow) > 0 || len(b.Deny) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointRateLimit returns the rate limit of the endpoint if specified, otherwise the common rate limit
+func endpointRateLimit(common *v1.RateLimit, e v1.Endpoint) *v1.RateLimit {
+	if e.RateLimit != nil {
+		return e.RateLimit
+	}
+	return common
+}
+
 func parseRateLimit(r *v1.RateLimit) *QosRatelimitRouter {
-	if r == nil {
+	if r == nil || r.Disabled {
 		return nil
 	}
 	return &QosRatelimitRouter{
@@ -131,22 +302,128 @@ func parseRateLimit(r *v1.RateLimit) *QosRatelimitRouter {
 	}
 }
 
-func findAuthProvider(k *v1.Krakend, auth *v1.Auth) (*AuthValidator, error) {
-	for _, p := range k.Spec.AuthProviders {
-		if p.Name == auth.Name {
-			return &AuthValidator{
-				OperationDebug: auth.Debug,
-				Alg:            p.Alg,
-				Cache:          auth.Cache,
-				JwkUrl:         p.JwkUrl,
-				Issuer:         p.Issuer,
-				Audience:       auth.Audience,
-				Scope:          auth.Scope,
-				ScopesKey:      DefaultScopesKey,
-			}, nil
+func parseBackendExtraConfig(spec v1.ApiEndpointsSpec, e v1.Endpoint) *BackendExtraConfig {
+	rateLimit := spec.BackendRateLimit
+	if e.BackendRateLimit != nil {
+		rateLimit = e.BackendRateLimit
+	}
+	circuitBreaker := spec.CircuitBreaker
+	if e.CircuitBreaker != nil {
+		circuitBreaker = e.CircuitBreaker
+	}
+
+	extraCfg := &BackendExtraConfig{}
+	if rateLimit != nil && !rateLimit.Disabled {
+		extraCfg.QosRatelimitProxy = &QosRatelimitProxy{
+			MaxRate:  rateLimit.MaxRate,
+			Capacity: rateLimit.Capacity,
+			Every:    rateLimit.Every,
+		}
+	}
+	if circuitBreaker != nil && !circuitBreaker.Disabled {
+		extraCfg.QosCircuitBreaker = &QosCircuitBreaker{
+			Interval:        circuitBreaker.Interval,
+			Timeout:         circuitBreaker.Timeout,
+			MaxErrors:       circuitBreaker.MaxErrors,
+			LogStatusChange: circuitBreaker.LogStatusChange,
+		}
+	}
+	if e.Cache != nil {
+		extraCfg.QosHttpCache = &QosHttpCache{
+			Shared:   e.Cache.Shared,
+			MaxItems: e.Cache.MaxItems,
+			MaxSize:  e.Cache.MaxSize,
+		}
+	}
+	if *extraCfg == (BackendExtraConfig{}) {
+		return nil
+	}
+	return extraCfg
+}
+
+func setBackendExtraConfig(endpoint *Endpoint, extraCfg *BackendExtraConfig) {
+	for _, b := range endpoint.Backend {
+		b.ExtraConfig = extraCfg
+	}
+}
+
+func findAuthProvider(k *v1.Krakend, catalogue AuthProviderCatalogue, auth *v1.Auth) (*AuthValidator, error) {
+	p, ok := catalogue.Lookup(k, auth.Name)
+	if !ok {
+		return nil, fmt.Errorf("%w: no auth provider with name '%s'", ErrAuthProviderNotFound, auth.Name)
+	}
+	alg := p.Alg
+	if alg == "" {
+		alg = DefaultAlg
+	}
+	claims := mergeClaims(p.Claims, auth.Claims)
+	validator := &AuthValidator{
+		OperationDebug:  auth.Debug,
+		Alg:             alg,
+		Cache:           auth.Cache,
+		JwkUrl:          p.JwkUrl,
+		Issuer:          p.Issuer,
+		Audience:        auth.Audience,
+		Scope:           auth.Scope,
+		ScopesKey:       claims.ScopesKey,
+		ScopesMatcher:   claims.ScopesMatcher,
+		Roles:           claims.Roles,
+		PropagateClaims: propagateClaims(claims.PropagateClaims),
+	}
+	if validator.ScopesKey == "" {
+		validator.ScopesKey = DefaultScopesKey
+	}
+	if len(validator.Roles) > 0 {
+		validator.RolesKey = claims.RolesKey
+		if validator.RolesKey == "" {
+			validator.RolesKey = DefaultRolesKey
+		}
+		validator.RolesKeyIsNested = strings.Contains(validator.RolesKey, ".")
+	}
+	return validator, nil
+}
+
+// mergeClaims returns the claim settings of the auth provider overridden by the ones set in the auth of the ApiEndpoints,
+// propagated claims are combined, with the auth taking precedence for the same header
+func mergeClaims(provider, auth v1.Claims) v1.Claims {
+	claims := provider
+	if auth.ScopesKey != "" {
+		claims.ScopesKey = auth.ScopesKey
+	}
+	if auth.ScopesMatcher != "" {
+		claims.ScopesMatcher = auth.ScopesMatcher
+	}
+	if auth.RolesKey != "" {
+		claims.RolesKey = auth.RolesKey
+	}
+	if len(auth.Roles) > 0 {
+		claims.Roles = auth.Roles
+	}
+	claims.PropagateClaims = make([]v1.PropagateClaim, 0, len(provider.PropagateClaims)+len(auth.PropagateClaims))
+	for _, c := range provider.PropagateClaims {
+		if !slices.ContainsFunc(auth.PropagateClaims, func(a v1.PropagateClaim) bool { return strings.EqualFold(a.Header, c.Header) }) {
+			claims.PropagateClaims = append(claims.PropagateClaims, c)
 		}
 	}
-	return nil, fmt.Errorf("auth provider with name '%s' not found", auth.Name)
+	claims.PropagateClaims = append(claims.PropagateClaims, auth.PropagateClaims...)
+	return claims
+}
+
+// propagateClaims returns the claims as pairs of claim and header, as expected by KrakenD
+func propagateClaims(claims []v1.PropagateClaim) [][]string {
+	if len(claims) == 0 {
+		return nil
+	}
+	pairs := make([][]string, 0, len(claims))
+	for _, c := range claims {
+		pairs = append(pairs, []string{c.Claim, c.Header})
+	}
+	return pairs
+}
+
+// IsAuthProviderNotFound returns true if the error is caused by an auth provider missing in the Krakend spec and the catalogue
+func IsAuthProviderNotFound(err error) bool {
+	return errors.Is(err, ErrAuthProviderNotFound)
 }
 
 func ParsePartials(content []byte) (*Partials, error) {
@@ -19,7 +19,7 @@ func TestParseKrakendEndpointsSpec(t *testing.T) {
 	err = parseYaml("testdata/krakend.yaml", k)
 	assert.NoError(t, err)
 
-	partials, err := parseKrakendEndpointsSpec(k, endpoints.Spec)
+	partials, err := parseKrakendEndpointsSpec(k, nil, endpoints.Spec)
 	assert.NoError(t, err)
 
 	_, err = json.Marshal(partials)
@@ -76,3 +76,211 @@ func TestParsePartials(t *testing.T) {
 
 	assert.Equal(t, 2, len(partials.Endpoints))
 }
+
+func TestParseKrakendEndpointsSpecWithBackends(t *testing.T) {
+	endpoints := &v1.ApiEndpoints{}
+	err := parseYaml("testdata/apiendpoints_backends.yaml", endpoints)
+	assert.NoError(t, err)
+
+	k := &v1.Krakend{}
+	err = parseYaml("testdata/krakend.yaml", k)
+	assert.NoError(t, err)
+
+	partials, err := parseKrakendEndpointsSpec(k, nil, endpoints.Spec)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(partials))
+
+	merged := partials[0]
+	assert.Equal(t, "/merged", merged.Endpoint)
+	assert.Equal(t, JsonEncoding, merged.OutputEncoding)
+	assert.Equal(t, 2, len(merged.Backend))
+	assert.Equal(t, []string{"http://app1", "http://app1-canary"}, merged.Backend[0].Host)
+	assert.Equal(t, "/user", merged.Backend[0].UrlPattern)
+	assert.Equal(t, "GET", merged.Backend[0].Method)
+	assert.Equal(t, JsonEncoding, merged.Backend[0].Encoding)
+	assert.Equal(t, "user", merged.Backend[0].Group)
+	assert.Equal(t, []string{"password"}, merged.Backend[0].Deny)
+	assert.Equal(t, "POST", merged.Backend[1].Method)
+	assert.Equal(t, "data", merged.Backend[1].Target)
+	assert.Equal(t, []string{"id", "total"}, merged.Backend[1].Allow)
+
+	balanced := partials[1]
+	assert.Equal(t, DefaultOutputEncoding, balanced.OutputEncoding)
+	assert.Equal(t, 1, len(balanced.Backend))
+	assert.Equal(t, DefaultOutputEncoding, balanced.Backend[0].Encoding)
+	assert.Equal(t, []string{"http://app1", "http://app1-canary"}, balanced.Backend[0].Host)
+}
+
+func TestParseKrakendEndpointsSpecWithOverrides(t *testing.T) {
+	endpoints := &v1.ApiEndpoints{}
+	err := parseYaml("testdata/apiendpoints_overrides.yaml", endpoints)
+	assert.NoError(t, err)
+
+	k := &v1.Krakend{}
+	err = parseYaml("testdata/krakend.yaml", k)
+	assert.NoError(t, err)
+
+	partials, err := parseKrakendEndpointsSpec(k, nil, endpoints.Spec)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(partials))
+
+	common := partials[0]
+	assert.Equal(t, "https://test.maskinporten.no/", common.ExtraConfig.AuthValidator.Issuer)
+	assert.Equal(t, []string{"org1:team1:krakend.app"}, common.ExtraConfig.AuthValidator.Scope)
+	assert.Equal(t, 10, common.ExtraConfig.QosRatelimitRouter.MaxRate)
+	assert.Equal(t, []*CelCheck{{CheckExpr: `JWT["consumer"]["ID"] in ["0192:889640782"]`}}, common.ExtraConfig.ValidationCel)
+
+	admin := partials[1]
+	assert.Equal(t, "https://mock-oauth2-server.dev.dev-nais.cloud.nais.io/debugger", admin.ExtraConfig.AuthValidator.Issuer)
+	assert.Equal(t, []string{"admin"}, admin.ExtraConfig.AuthValidator.Scope)
+	assert.Equal(t, []string{"app1-admin"}, admin.ExtraConfig.AuthValidator.Audience)
+	assert.Equal(t, 1, admin.ExtraConfig.QosRatelimitRouter.MaxRate)
+	assert.Equal(t, "header", admin.ExtraConfig.QosRatelimitRouter.Strategy)
+	assert.Equal(t, "Authorization", admin.ExtraConfig.QosRatelimitRouter.Key)
+	assert.Empty(t, admin.ExtraConfig.ValidationCel)
+
+	doc := partials[2]
+	assert.Nil(t, doc.ExtraConfig.AuthValidator)
+	assert.Nil(t, doc.ExtraConfig.QosRatelimitRouter)
+	assert.Empty(t, doc.ExtraConfig.ValidationCel)
+
+	endpoints.Spec.Endpoints[1].Auth.Name = "doesnotexist"
+	_, err = parseKrakendEndpointsSpec(k, nil, endpoints.Spec)
+	assert.True(t, IsAuthProviderNotFound(err))
+}
+
+func TestParseKrakendEndpointsSpecWithClaims(t *testing.T) {
+	endpoints := &v1.ApiEndpoints{}
+	err := parseYaml("testdata/apiendpoints_azuread.yaml", endpoints)
+	assert.NoError(t, err)
+
+	k := &v1.Krakend{}
+	err = parseYaml("testdata/krakend.yaml", k)
+	assert.NoError(t, err)
+
+	partials, err := parseKrakendEndpointsSpec(k, nil, endpoints.Spec)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(partials))
+
+	delegated := partials[0].ExtraConfig.AuthValidator
+	assert.Equal(t, "scp", delegated.ScopesKey)
+	assert.Equal(t, "all", delegated.ScopesMatcher)
+	assert.Equal(t, []string{"read", "write"}, delegated.Scope)
+	assert.Empty(t, delegated.Roles)
+	assert.Empty(t, delegated.RolesKey)
+	assert.Equal(t, [][]string{{"oid", "X-User"}, {"azp_name", "X-Client"}}, delegated.PropagateClaims)
+	assert.Equal(t, []string{"Accept", "x-user", "X-Client"}, partials[0].InputHeaders)
+	assert.Equal(t, []string{"Accept", "x-user"}, endpoints.Spec.Endpoints[0].ForwardHeaders)
+
+	admin := partials[1].ExtraConfig.AuthValidator
+	assert.Equal(t, "scp", admin.ScopesKey)
+	assert.Equal(t, "any", admin.ScopesMatcher)
+	assert.Equal(t, []string{"admin"}, admin.Roles)
+	assert.Equal(t, "roles", admin.RolesKey)
+	assert.False(t, admin.RolesKeyIsNested)
+	assert.Equal(t, [][]string{{"oid", "X-User"}, {"roles", "X-Client"}}, admin.PropagateClaims)
+	assert.Equal(t, []string{"X-User", "X-Client"}, partials[1].InputHeaders)
+
+	nested := partials[2].ExtraConfig.AuthValidator
+	assert.Equal(t, "realm_access.roles", nested.RolesKey)
+	assert.True(t, nested.RolesKeyIsNested)
+
+	content, err := json.Marshal(admin)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"roles_key":"roles"`)
+	assert.Contains(t, string(content), `"propagate_claims":[["oid","X-User"],["roles","X-Client"]]`)
+}
+
+func TestParseKrakendEndpointsSpecWithApiKeys(t *testing.T) {
+	endpoints := &v1.ApiEndpoints{}
+	err := parseYaml("testdata/apiendpoints.yaml", endpoints)
+	assert.NoError(t, err)
+	endpoints.Spec.Auth = v1.Auth{ApiKeys: &v1.ApiKeysAuth{Roles: []string{"read"}}}
+
+	k := &v1.Krakend{}
+	err = parseYaml("testdata/krakend.yaml", k)
+	assert.NoError(t, err)
+
+	_, err = parseKrakendEndpointsSpec(k, nil, endpoints.Spec)
+	assert.ErrorIs(t, err, ErrAuthProviderNotFound)
+
+	k.Spec.ApiKeys = &v1.ApiKeys{Keys: []v1.ApiKey{{Name: "partner", Roles: []string{"read"}}}}
+	partials, err := parseKrakendEndpointsSpec(k, nil, endpoints.Spec)
+	assert.NoError(t, err)
+	assert.Equal(t, len(endpoints.Spec.Endpoints)+len(endpoints.Spec.OpenEndpoints), len(partials))
+	for _, p := range partials[:len(endpoints.Spec.Endpoints)] {
+		assert.Nil(t, p.ExtraConfig.AuthValidator)
+		assert.Equal(t, []string{"read"}, p.ExtraConfig.AuthApiKeys.Roles)
+	}
+
+	content, err := json.Marshal(partials[0].ExtraConfig)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"auth/api-keys":{"roles":["read"]}`)
+	assert.NotContains(t, string(content), "auth/validator")
+}
+
+func TestFindAuthProviderDefaultAlg(t *testing.T) {
+	k := &v1.Krakend{Spec: v1.KrakendSpec{AuthProviders: []v1.AuthProvider{
+		{Name: "maskinporten", JwkUrl: "https://test.maskinporten.no/jwk", Issuer: "https://test.maskinporten.no/"},
+	}}}
+	validator, err := findAuthProvider(k, nil, &v1.Auth{Name: "maskinporten"})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultAlg, validator.Alg)
+}
+
+func TestInputHeaders(t *testing.T) {
+	auth := &AuthValidator{PropagateClaims: [][]string{{"consumer.ID", "X-Consumer"}}}
+	assert.Equal(t, []string{"X-Consumer"}, inputHeaders(nil, auth))
+	assert.Equal(t, []string{"Accept", "X-Consumer"}, inputHeaders([]string{"Accept"}, auth))
+	assert.Equal(t, []string{"x-consumer"}, inputHeaders([]string{"x-consumer"}, auth))
+	assert.Equal(t, []string{"*"}, inputHeaders([]string{"*"}, auth))
+	assert.Equal(t, []string{"Accept"}, inputHeaders([]string{"Accept"}, &AuthValidator{}))
+}
+
+func TestParseKrakendEndpointsSpecWithBackendQos(t *testing.T) {
+	endpoints := &v1.ApiEndpoints{}
+	err := parseYaml("testdata/apiendpoints_backend_qos.yaml", endpoints)
+	assert.NoError(t, err)
+
+	k := &v1.Krakend{}
+	err = parseYaml("testdata/krakend.yaml", k)
+	assert.NoError(t, err)
+
+	partials, err := parseKrakendEndpointsSpec(k, nil, endpoints.Spec)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(partials))
+
+	legacy := partials[0]
+	assert.Equal(t, 2, len(legacy.Backend))
+	for _, b := range legacy.Backend {
+		assert.Equal(t, 100, b.ExtraConfig.QosRatelimitProxy.MaxRate)
+		assert.Equal(t, 50, b.ExtraConfig.QosRatelimitProxy.Capacity)
+		assert.Equal(t, "1s", b.ExtraConfig.QosRatelimitProxy.Every)
+		assert.Equal(t, 60, b.ExtraConfig.QosCircuitBreaker.Interval)
+		assert.Equal(t, 10, b.ExtraConfig.QosCircuitBreaker.Timeout)
+		assert.Equal(t, 5, b.ExtraConfig.QosCircuitBreaker.MaxErrors)
+		assert.True(t, b.ExtraConfig.QosCircuitBreaker.LogStatusChange)
+	}
+
+	fragile := partials[1]
+	assert.Equal(t, 1, fragile.Backend[0].ExtraConfig.QosRatelimitProxy.MaxRate)
+	assert.Nil(t, fragile.Backend[0].ExtraConfig.QosCircuitBreaker)
+
+	assert.Nil(t, legacy.Backend[0].ExtraConfig.QosHttpCache)
+
+	doc := partials[2]
+	assert.Nil(t, doc.Backend[0].ExtraConfig)
+
+	cached := partials[3]
+	assert.True(t, cached.Backend[0].ExtraConfig.QosHttpCache.Shared)
+	assert.Equal(t, 100, cached.Backend[0].ExtraConfig.QosHttpCache.MaxItems)
+
+	cachedDefaults, err := json.Marshal(partials[4].Backend[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(cachedDefaults), `"extra_config":{"qos/http-cache":{}}`)
+
+	b, err := json.Marshal(legacy.Backend[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"qos/ratelimit/proxy":{"max_rate":100,"capacity":50,"every":"1s"}`)
+	assert.Contains(t, string(b), `"qos/circuit-breaker":{"interval":60,"timeout":10,"max_errors":5,"log_status_change":true}`)
+}
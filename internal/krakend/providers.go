@@ -0,0 +1,110 @@
+package krakend
+
+import (
+	"fmt"
+	"os"
+
+	v1 "github.com/nais/krakend/api/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+)
+
+const DefaultAlg = "RS256"
+
+// AuthProviderPresets are the settings of the well-known auth providers, applied to the auth providers of the catalogue
+// with the same name. The URLs differ between environments, and are given by the catalogue.
+var AuthProviderPresets = map[string]v1.AuthProvider{
+	// the organization number of the consumer is in consumer.ID, e.g. 0192:889640782
+	"maskinporten": {Alg: DefaultAlg, Claims: v1.Claims{
+		PropagateClaims: []v1.PropagateClaim{{Claim: "consumer.ID", Header: "X-Consumer-ID"}},
+	}},
+	// the security level of the login is in acr, e.g. idporten-loa-high
+	"idporten": {Alg: DefaultAlg, Claims: v1.Claims{
+		PropagateClaims: []v1.PropagateClaim{{Claim: "acr", Header: "X-Acr"}},
+	}},
+	// the calling application is in client_id, e.g. dev-gcp:team1:app1
+	"tokenx": {Alg: DefaultAlg, Claims: v1.Claims{
+		PropagateClaims: []v1.PropagateClaim{{Claim: "client_id", Header: "X-Client-ID"}},
+	}},
+	// delegated scopes are in scp, app roles in roles
+	"azuread": {Alg: DefaultAlg, Claims: v1.Claims{ScopesKey: "scp"}},
+}
+
+// audienceRequired are the auth providers issuing tokens for any application, the tokens are only meant for the API
+// of the ApiEndpoints if their audience is validated
+var audienceRequired = sets.New("idporten", "tokenx")
+
+// RequiresAudience returns true if ApiEndpoints using the auth provider must validate the audience of the tokens
+func RequiresAudience(name string) bool {
+	return audienceRequired.Has(name)
+}
+
+// AuthProviderCatalogue is the cluster-level catalogue of auth providers, used for the auth providers referenced by
+// ApiEndpoints which are not defined in their Krakend. A nil catalogue is empty.
+type AuthProviderCatalogue []v1.AuthProvider
+
+// LoadAuthProviderCatalogue reads a catalogue of auth providers from a YAML file, in the format of spec.authProviders of
+// a Krakend. Settings missing in the file are taken from the preset with the same name.
+func LoadAuthProviderCatalogue(file string) (AuthProviderCatalogue, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading auth provider catalogue: %w", err)
+	}
+	providers := make(AuthProviderCatalogue, 0)
+	if err := yaml.UnmarshalStrict(content, &providers); err != nil {
+		return nil, fmt.Errorf("parsing auth provider catalogue %s: %w", file, err)
+	}
+
+	names := sets.New[string]()
+	for i, p := range providers {
+		if p.Name == "" || p.JwkUrl == "" || p.Issuer == "" {
+			return nil, fmt.Errorf("auth provider %d in catalogue %s: name, jwkUrl and issuer are required", i, file)
+		}
+		if names.Has(p.Name) {
+			return nil, fmt.Errorf("auth provider '%s' is defined more than once in catalogue %s", p.Name, file)
+		}
+		names.Insert(p.Name)
+		providers[i] = withPreset(p)
+	}
+	return providers, nil
+}
+
+// withPreset returns the auth provider with the settings it does not set taken from its preset
+func withPreset(p v1.AuthProvider) v1.AuthProvider {
+	preset, ok := AuthProviderPresets[p.Name]
+	if !ok {
+		preset = v1.AuthProvider{Alg: DefaultAlg}
+	}
+	if p.Alg == "" {
+		p.Alg = preset.Alg
+	}
+	p.Claims = mergeClaims(preset.Claims, p.Claims)
+	return p
+}
+
+// Lookup returns the auth provider with the given name in the Krakend, or in the catalogue if the Krakend does not
+// define it
+func (c AuthProviderCatalogue) Lookup(k *v1.Krakend, name string) (v1.AuthProvider, bool) {
+	for _, p := range c.AuthProviders(k) {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return v1.AuthProvider{}, false
+}
+
+// AuthProviders returns the auth providers available to the ApiEndpoints of the Krakend, the ones defined in the
+// Krakend followed by the ones in the catalogue it does not override
+func (c AuthProviderCatalogue) AuthProviders(k *v1.Krakend) []v1.AuthProvider {
+	providers := append([]v1.AuthProvider{}, k.Spec.AuthProviders...)
+	defined := sets.New[string]()
+	for _, p := range k.Spec.AuthProviders {
+		defined.Insert(p.Name)
+	}
+	for _, p := range c {
+		if !defined.Has(p.Name) {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
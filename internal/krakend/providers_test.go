@@ -0,0 +1,114 @@
+package krakend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/nais/krakend/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAuthProviderCatalogue(t *testing.T) {
+	providers, err := LoadAuthProviderCatalogue("testdata/auth-providers.yaml")
+	assert.NoError(t, err)
+	assert.Len(t, providers, 3)
+
+	assert.Equal(t, "maskinporten", providers[0].Name)
+	assert.Equal(t, "RS256", providers[0].Alg)
+	assert.Empty(t, providers[0].ScopesKey)
+	assert.Equal(t, "RS256", providers[1].Alg)
+	assert.Equal(t, "scp", providers[1].ScopesKey)
+	assert.Equal(t, "ES256", providers[2].Alg)
+	assert.Equal(t, "permissions", providers[2].ScopesKey)
+
+	dir := t.TempDir()
+	for content, msg := range map[string]string{
+		"- name: maskinporten\n  issuer: https://test.maskinporten.no/\n":                                                    "jwkUrl and issuer are required",
+		"- name: a\n  jwkUrl: https://a/jwk\n  issuer: https://a\n- name: a\n  jwkUrl: https://a/jwk\n  issuer: https://a\n": "defined more than once",
+		"- name: a\n  jwksUrl: https://a/jwk\n":                                                                              "unknown field",
+	} {
+		file := filepath.Join(dir, "auth-providers.yaml")
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+		_, err := LoadAuthProviderCatalogue(file)
+		assert.ErrorContains(t, err, msg)
+	}
+}
+
+func TestAuthProviderPresets(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "auth-providers.yaml")
+	content := `
+- name: maskinporten
+  jwkUrl: https://test.maskinporten.no/jwk
+  issuer: https://test.maskinporten.no/
+- name: idporten
+  jwkUrl: https://test.idporten.no/jwks.json
+  issuer: https://test.idporten.no
+- name: tokenx
+  jwkUrl: https://tokenx.dev-gcp.nav.cloud.nais.io/jwks
+  issuer: https://tokenx.dev-gcp.nav.cloud.nais.io
+- name: other
+  jwkUrl: https://auth.example.com/jwks
+  issuer: https://auth.example.com
+`
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	catalogue, err := LoadAuthProviderCatalogue(file)
+	assert.NoError(t, err)
+	k := &v1.Krakend{}
+
+	for name, expected := range map[string][][]string{
+		"maskinporten": {{"consumer.ID", "X-Consumer-ID"}},
+		"idporten":     {{"acr", "X-Acr"}},
+		"tokenx":       {{"client_id", "X-Client-ID"}},
+		"other":        nil,
+	} {
+		validator, err := findAuthProvider(k, catalogue, &v1.Auth{Name: name})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, validator.PropagateClaims, name)
+	}
+
+	// the claims of the auth are added to the ones of the preset, and take precedence for the same header
+	validator, err := findAuthProvider(k, catalogue, &v1.Auth{Name: "maskinporten", Claims: v1.Claims{
+		PropagateClaims: []v1.PropagateClaim{{Claim: "consumer.authority", Header: "x-consumer-id"}, {Claim: "scope", Header: "X-Scope"}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"consumer.authority", "x-consumer-id"}, {"scope", "X-Scope"}}, validator.PropagateClaims)
+
+	assert.True(t, RequiresAudience("tokenx"))
+	assert.True(t, RequiresAudience("idporten"))
+	assert.False(t, RequiresAudience("maskinporten"))
+}
+
+func TestFindAuthProviderInCatalogue(t *testing.T) {
+	catalogue, err := LoadAuthProviderCatalogue("testdata/auth-providers.yaml")
+	assert.NoError(t, err)
+
+	k := &v1.Krakend{}
+	err = parseYaml("testdata/krakend.yaml", k)
+	assert.NoError(t, err)
+
+	// the Krakend overrides the catalogue
+	validator, err := findAuthProvider(k, catalogue, &v1.Auth{Name: "azuread"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://login.microsoftonline.com/tenant/v2.0", validator.Issuer)
+	assert.Len(t, validator.PropagateClaims, 2)
+
+	validator, err = findAuthProvider(k, catalogue, &v1.Auth{Name: "internal", Scope: []string{"read"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://auth.example.com", validator.Issuer)
+	assert.Equal(t, "ES256", validator.Alg)
+	assert.Equal(t, "permissions", validator.ScopesKey)
+
+	names := make([]string, 0)
+	for _, p := range catalogue.AuthProviders(k) {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"mock-oauth2-server", "maskinporten", "azuread", "internal"}, names)
+
+	_, err = findAuthProvider(k, catalogue, &v1.Auth{Name: "tokenx"})
+	assert.True(t, IsAuthProviderNotFound(err))
+
+	// without a catalogue only the auth providers of the Krakend are available
+	_, err = findAuthProvider(k, nil, &v1.Auth{Name: "internal"})
+	assert.True(t, IsAuthProviderNotFound(err))
+}
@@ -0,0 +1,302 @@
+// Package lint validates Krakend and ApiEndpoints manifests offline, with the same validation as the admission webhooks
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/krakend"
+	"github.com/nais/krakend/internal/webhook"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Problem is a violation found in a manifest
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// Result is the outcome of linting a set of manifests
+type Result struct {
+	// Partials are the endpoints rendered from the valid ApiEndpoints, keyed by the namespace/name of the Krakend
+	Partials map[string][]*krakend.Endpoint
+	// Krakends are the Krakends read from the manifests, keyed by namespace/name
+	Krakends map[string]*krakendv1.Krakend
+	// ApiEndpoints are the valid ApiEndpoints, with defaults, keyed by the namespace/name of the Krakend they target
+	ApiEndpoints map[string][]krakendv1.ApiEndpoints
+	Problems     []Problem
+}
+
+// document is a single YAML document of a manifest file
+type document struct {
+	file string
+	node *yaml.Node
+}
+
+type krakendDocument struct {
+	document
+	obj *krakendv1.Krakend
+}
+
+type apiEndpointsDocument struct {
+	document
+	obj *krakendv1.ApiEndpoints
+}
+
+var fieldPathPattern = regexp.MustCompile(`([^.\[\]]+)|\[(\d+)\]`)
+
+// Lint reads the Krakend and ApiEndpoints manifests in the files, or in the YAML files of directories, and validates them
+// as they would be validated when applied in order, with the catalogue of auth providers of the operator. Resources
+// without a namespace are placed in namespace.
+func Lint(paths []string, namespace string, catalogue krakend.AuthProviderCatalogue) (*Result, error) {
+	files, err := manifestFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Partials:     make(map[string][]*krakend.Endpoint),
+		Krakends:     make(map[string]*krakendv1.Krakend),
+		ApiEndpoints: make(map[string][]krakendv1.ApiEndpoints),
+	}
+	krakends := make([]krakendDocument, 0)
+	apiEndpoints := make([]apiEndpointsDocument, 0)
+	for _, file := range files {
+		docs, err := readDocuments(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range docs {
+			meta := &struct {
+				Kind string `yaml:"kind"`
+			}{}
+			if err := d.node.Decode(meta); err != nil {
+				result.problem(d, "", fmt.Sprintf("decoding document: %v", err))
+				continue
+			}
+			switch meta.Kind {
+			case "Krakend":
+				k := &krakendv1.Krakend{}
+				if err := d.decode(k); err != nil {
+					result.problem(d, "", err.Error())
+					continue
+				}
+				if k.Namespace == "" {
+					k.Namespace = namespace
+				}
+				krakends = append(krakends, krakendDocument{document: d, obj: k})
+			case "ApiEndpoints":
+				a := &krakendv1.ApiEndpoints{}
+				if err := d.decode(a); err != nil {
+					result.problem(d, "", err.Error())
+					continue
+				}
+				if a.Namespace == "" {
+					a.Namespace = namespace
+				}
+				apiEndpoints = append(apiEndpoints, apiEndpointsDocument{document: d, obj: a})
+			}
+		}
+	}
+
+	// rejected Krakends would not exist in the cluster, so the ApiEndpoints targeting them are not validated against them
+	acceptedKrakends := make([]krakendDocument, 0)
+	for _, k := range krakends {
+		errs := webhook.ValidateKrakend(k.obj)
+		if len(errs) > 0 {
+			result.fieldProblems(k.document, errs)
+			continue
+		}
+		acceptedKrakends = append(acceptedKrakends, k)
+	}
+
+	valid := make(map[string][]krakendv1.ApiEndpoints)
+	accepted := make([]krakendv1.ApiEndpoints, 0)
+	for _, a := range apiEndpoints {
+		// defaults are set by the mutating webhook before validation
+		a.obj.Default()
+
+		k := findKrakend(acceptedKrakends, a.obj.Namespace, a.obj.KrakendName())
+		if k == nil {
+			result.problem(a.document, "spec.krakend", fmt.Sprintf("%s: %s/%s", webhook.MsgKrakendDoesNotExist, a.obj.Namespace, a.obj.KrakendName()))
+			continue
+		}
+
+		// as when applied in order, each ApiEndpoints is validated against the ones accepted before it, rejected ones
+		// would not exist in the cluster
+		existing := &krakendv1.ApiEndpointsList{}
+		for _, previous := range accepted {
+			if previous.Namespace == a.obj.Namespace {
+				existing.Items = append(existing.Items, previous)
+			}
+		}
+		errs := webhook.ValidateApiEndpoints(k.obj, catalogue, a.obj, existing).ErrorList()
+		if len(errs) > 0 {
+			result.fieldProblems(a.document, errs)
+			continue
+		}
+
+		if _, err := krakend.ToKrakendEndpoints(k.obj, catalogue, []krakendv1.ApiEndpoints{*a.obj}); err != nil {
+			result.problem(a.document, "", fmt.Sprintf("rendering endpoints: %v", err))
+			continue
+		}
+		key := fmt.Sprintf("%s/%s", k.obj.Namespace, k.obj.Name)
+		valid[key] = append(valid[key], *a.obj)
+		accepted = append(accepted, *a.obj)
+	}
+
+	for _, k := range acceptedKrakends {
+		key := fmt.Sprintf("%s/%s", k.obj.Namespace, k.obj.Name)
+		endpoints, err := krakend.ToKrakendEndpoints(k.obj, catalogue, valid[key])
+		if err != nil {
+			result.problem(k.document, "", fmt.Sprintf("rendering endpoints: %v", err))
+			continue
+		}
+		result.Partials[key] = endpoints
+		result.Krakends[key] = k.obj
+		result.ApiEndpoints[key] = valid[key]
+	}
+	return result, nil
+}
+
+func (r *Result) problem(d document, fieldPath, message string) {
+	r.Problems = append(r.Problems, Problem{File: d.file, Line: d.line(fieldPath), Message: message})
+}
+
+// fieldProblems adds the errors of a document in the order of their lines
+func (r *Result) fieldProblems(d document, errs field.ErrorList) {
+	problems := make([]Problem, 0)
+	for _, err := range errs {
+		problems = append(problems, Problem{File: d.file, Line: d.line(err.Field), Message: err.Error()})
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	r.Problems = append(r.Problems, problems...)
+}
+
+func findKrakend(krakends []krakendDocument, namespace, name string) *krakendDocument {
+	for i, k := range krakends {
+		if k.obj.Namespace == namespace && k.obj.Name == name {
+			return &krakends[i]
+		}
+	}
+	return nil
+}
+
+// manifestFiles returns the files, and the YAML files in directories, in lexical order per directory
+func manifestFiles(paths []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches := make([]string, 0)
+		err = filepath.WalkDir(p, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && (filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml") {
+				matches = append(matches, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+func readDocuments(file string) ([]document, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]document, 0)
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		node := &yaml.Node{}
+		err := decoder.Decode(node)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		docs = append(docs, document{file: file, node: node.Content[0]})
+	}
+}
+
+// decode decodes the document into v using the json tags of the API types, unknown fields are reported as errors
+func (d document) decode(v any) error {
+	m := make(map[string]any)
+	if err := d.node.Decode(&m); err != nil {
+		return fmt.Errorf("decoding document: %w", err)
+	}
+	j, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("decoding document: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(j))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("decoding document: %w", err)
+	}
+	return nil
+}
+
+// line returns the line of the field in the document, e.g. spec.endpoints[0].path, or of the closest parent found
+func (d document) line(fieldPath string) int {
+	node := d.node
+	for _, m := range fieldPathPattern.FindAllStringSubmatch(fieldPath, -1) {
+		next := child(node, m[1], m[2])
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return node.Line
+}
+
+func child(node *yaml.Node, key, index string) *yaml.Node {
+	switch {
+	case node.Kind == yaml.MappingNode && key != "":
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	case node.Kind == yaml.SequenceNode && index != "":
+		i, err := strconv.Atoi(index)
+		if err == nil && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/nais/krakend/internal/krakend"
+	"github.com/nais/krakend/internal/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	result, err := Lint([]string{"testdata/krakend.yaml", "testdata/apiendpoints.yaml"}, "team1", nil)
+	assert.NoError(t, err)
+
+	lines := make([]string, 0)
+	for _, p := range result.Problems {
+		lines = append(lines, p.String())
+	}
+	assert.Equal(t, []string{
+		`testdata/apiendpoints.yaml:19: spec: Forbidden: duplicate paths in apiendpoints resource: GET /app1/users/{name} in app2 and GET /app1/users/{id} in app1 have the same path`,
+		`testdata/apiendpoints.yaml:24: spec.endpoints[0].backendHost: Invalid value: "app2": must be an absolute http or https URL`,
+		`testdata/apiendpoints.yaml:26: spec.endpoints[0].timeout: Invalid value: "forever": must be a valid duration, e.g. 2s or 500ms`,
+		`testdata/apiendpoints.yaml:36: the referenced Krakend does not exist: team1/doesnotexist`,
+	}, lines)
+
+	partials := result.Partials["team1/team1"]
+	assert.Len(t, partials, 1)
+	assert.Equal(t, "/app1/users/{id}", partials[0].Endpoint)
+	assert.Equal(t, "GET", partials[0].Method)
+
+	assert.Equal(t, "team1", result.Krakends["team1/team1"].Name)
+	assert.Len(t, result.ApiEndpoints["team1/team1"], 1)
+	assert.Equal(t, "app1", result.ApiEndpoints["team1/team1"][0].Name)
+}
+
+func TestLintRejectedDoesNotConflict(t *testing.T) {
+	result, err := Lint([]string{"testdata/krakend.yaml", "testdata/rejected.yaml"}, "team1", nil)
+	assert.NoError(t, err)
+
+	// app4 is rejected, so the same path in app5 does not conflict with it
+	assert.Len(t, result.Problems, 1)
+	assert.Equal(t, `testdata/rejected.yaml:11: spec.endpoints[0].backendHost: Invalid value: "app4": must be an absolute http or https URL`, result.Problems[0].String())
+	assert.Len(t, result.ApiEndpoints["team1/team1"], 1)
+	assert.Equal(t, "app5", result.ApiEndpoints["team1/team1"][0].Name)
+}
+
+func TestLintRejectedKrakend(t *testing.T) {
+	result, err := Lint([]string{"testdata/krakend.yaml", "testdata/rejected_krakend.yaml"}, "team1", nil)
+	assert.NoError(t, err)
+
+	// team2 has no ingress host, so it is rejected and app7 targets a Krakend which would not exist
+	lines := make([]string, 0)
+	for _, p := range result.Problems {
+		lines = append(lines, p.String())
+	}
+	assert.Equal(t, []string{
+		`testdata/rejected_krakend.yaml:7: spec.ingressHost: Required value: ` + webhook.MsgIngressHostMissing,
+		`testdata/rejected_krakend.yaml:18: the referenced Krakend does not exist: team1/team2`,
+	}, lines)
+	assert.NotContains(t, result.Krakends, "team1/team2")
+	assert.NotContains(t, result.Partials, "team1/team2")
+}
+
+func TestLintAuthProviderCatalogue(t *testing.T) {
+	files := []string{"testdata/krakend.yaml", "testdata/catalogue.yaml"}
+	result, err := Lint(files, "team1", nil)
+	assert.NoError(t, err)
+	assert.Len(t, result.Problems, 1)
+	assert.Contains(t, result.Problems[0].Message, "auth provider tokenx not found")
+
+	catalogue := krakend.AuthProviderCatalogue{{Name: "tokenx", Alg: "RS256", JwkUrl: "https://tokenx/jwks", Issuer: "https://tokenx"}}
+	result, err = Lint(files, "team1", catalogue)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Problems)
+	assert.Equal(t, "https://tokenx", result.Partials["team1/team1"][0].ExtraConfig.AuthValidator.Issuer)
+}
+
+func TestLintSamples(t *testing.T) {
+	result, err := Lint([]string{"../../config/samples"}, "team1", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Problems)
+	assert.NotEmpty(t, result.Partials["team1/team1"])
+}
+
+func TestLintUnknownFields(t *testing.T) {
+	result, err := Lint([]string{"testdata/unknown_fields.yaml"}, "team1", nil)
+	assert.NoError(t, err)
+	assert.Len(t, result.Problems, 1)
+	assert.Contains(t, result.Problems[0].Message, `unknown field "scope"`)
+}
@@ -0,0 +1,96 @@
+// Package metrics defines the Prometheus metrics of the operator, served by the controller-runtime metrics server
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "krakend_operator"
+
+var (
+	// ApiEndpoints is the number of ApiEndpoints rendered into the partials of a Krakend
+	ApiEndpoints = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "apiendpoints",
+		Help:      "Number of ApiEndpoints rendered into the partials of a Krakend",
+	}, []string{"namespace", "krakend"})
+
+	// Endpoints is the number of endpoints in the partials of a Krakend
+	Endpoints = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "endpoints",
+		Help:      "Number of endpoints in the partials of a Krakend",
+	}, []string{"namespace", "krakend"})
+
+	// PartialsSize is the size of the data in the partials ConfigMap of a Krakend, or in its shards when sharded
+	PartialsSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "partials_configmap_bytes",
+		Help:      "Size in bytes of the data in the partials ConfigMap of a Krakend, or in its shards when sharded",
+	}, []string{"namespace", "krakend"})
+
+	// PartialsCapacity is the size limit of the partials of a Krakend, the ConfigMap size limit times the number of ConfigMaps
+	PartialsCapacity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "partials_capacity_bytes",
+		Help:      "Size limit in bytes of the partials of a Krakend, across the partials ConfigMap or its shards",
+	}, []string{"namespace", "krakend"})
+
+	// PartialsWarning is the size of the partials of a Krakend at which the operator warns that the limit is near
+	PartialsWarning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "partials_warning_bytes",
+		Help:      "Size in bytes of the partials of a Krakend at which the PartialsNearLimit warning is raised",
+	}, []string{"namespace", "krakend"})
+
+	// ReconcileFailures counts failed reconciliations by controller and the reason set on the status conditions
+	ReconcileFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_failures_total",
+		Help:      "Number of failed reconciliations by controller and reason",
+	}, []string{"controller", "reason"})
+
+	// WebhookDenials counts requests denied by the admission webhooks by webhook and reason
+	WebhookDenials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_denials_total",
+		Help:      "Number of requests denied by the admission webhooks by webhook and reason",
+	}, []string{"webhook", "reason"})
+
+	// HelmRenderDuration is the duration of rendering the KrakenD chart
+	HelmRenderDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "helm_render_duration_seconds",
+		Help:      "Duration of rendering the KrakenD chart for a Krakend",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 10),
+	})
+
+	// LastSuccessfulSync is the time of the last reconciliation of a Krakend where all resources were applied
+	LastSuccessfulSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_sync_timestamp_seconds",
+		Help:      "Unix time of the last reconciliation of a Krakend where all resources were applied",
+	}, []string{"namespace", "krakend"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		ApiEndpoints,
+		Endpoints,
+		PartialsSize,
+		PartialsCapacity,
+		PartialsWarning,
+		ReconcileFailures,
+		WebhookDenials,
+		HelmRenderDuration,
+		LastSuccessfulSync,
+	)
+}
+
+// DeleteKrakend removes the series of a Krakend, so deleted Krakends are not reported
+func DeleteKrakend(namespace, name string) {
+	for _, v := range []*prometheus.GaugeVec{ApiEndpoints, Endpoints, PartialsSize, PartialsCapacity, PartialsWarning, LastSuccessfulSync} {
+		v.DeleteLabelValues(namespace, name)
+	}
+}
@@ -0,0 +1,78 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+)
+
+// serviceExtraConfig is the service-level extra_config in the config of the chart, which follows the endpoints
+const serviceExtraConfig = `"extra_config": `
+
+// apiKeys is the service-level auth/api-keys config of KrakenD, see
+// https://www.krakend.io/docs/enterprise/authentication/api-keys/
+type apiKeys struct {
+	Strategy   string   `json:"strategy,omitempty"`
+	Identifier string   `json:"identifier,omitempty"`
+	Keys       []apiKey `json:"keys"`
+}
+
+type apiKey struct {
+	Description string   `json:"@description"`
+	Key         string   `json:"key"`
+	Roles       []string `json:"roles"`
+}
+
+// ApiKeyFile is the name of the file with the API key in the partials directory of KrakenD, where its Secret is mounted
+func ApiKeyFile(key krakendv1.ApiKey) string {
+	return fmt.Sprintf("apikey_%s", key.Name)
+}
+
+// ApiKeysConfig returns the config of the chart with the API keys of the Krakend added to the service-level
+// extra_config. The keys are not part of the config, they are read at startup from the files of their Secrets.
+func ApiKeysConfig(config string, k *krakendv1.Krakend) (string, error) {
+	if k.Spec.ApiKeys == nil {
+		return config, nil
+	}
+	i := strings.LastIndex(config, serviceExtraConfig)
+	if i < 0 {
+		return "", fmt.Errorf("config has no service extra_config to add the API keys to")
+	}
+	head, rest := config[:i+len(serviceExtraConfig)], strings.TrimLeft(config[i+len(serviceExtraConfig):], " \t\n")
+
+	keys := &apiKeys{
+		Strategy:   k.Spec.ApiKeys.Strategy,
+		Identifier: k.Spec.ApiKeys.Identifier,
+		Keys:       make([]apiKey, 0, len(k.Spec.ApiKeys.Keys)),
+	}
+	for _, key := range k.Spec.ApiKeys.Keys {
+		roles := key.Roles
+		if roles == nil {
+			roles = []string{}
+		}
+		keys.Keys = append(keys.Keys, apiKey{Description: key.Name, Key: ApiKeyFile(key), Roles: roles})
+	}
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return "", fmt.Errorf("marshalling API keys: %w", err)
+	}
+	block := string(b)
+	// the keys are read from their files when KrakenD resolves the flexible config
+	for _, key := range k.Spec.ApiKeys.Keys {
+		block = strings.Replace(block, `"key":"`+ApiKeyFile(key)+`"`, `"key":{{ include "`+ApiKeyFile(key)+`" | trim | marshal }}`, 1)
+	}
+	block = `"auth/api-keys":` + block
+
+	switch {
+	case strings.HasPrefix(rest, "null"):
+		return head + "{" + block + "}" + rest[len("null"):], nil
+	case strings.HasPrefix(rest, "{}"):
+		return head + "{" + block + rest[1:], nil
+	case strings.HasPrefix(rest, "{"):
+		return head + "{" + block + "," + rest[1:], nil
+	default:
+		return "", fmt.Errorf("service extra_config of the config is not an object")
+	}
+}
@@ -0,0 +1,55 @@
+package render
+
+import (
+	"fmt"
+	"testing"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestApiKeysConfig(t *testing.T) {
+	k := &krakendv1.Krakend{
+		Spec: krakendv1.KrakendSpec{
+			ApiKeys: &krakendv1.ApiKeys{
+				Strategy:   "header",
+				Identifier: "X-Api-Key",
+				Keys: []krakendv1.ApiKey{
+					{Name: "partner1", SecretKeyRef: corev1.SecretKeySelector{Key: "key"}, Roles: []string{"read", "write"}},
+					{Name: "partner2", SecretKeyRef: corev1.SecretKeySelector{Key: "key"}},
+				},
+			},
+		},
+	}
+	fc := &flexibleConfig{
+		partials: map[string]string{
+			"apikey_partner1": "secret1\n",
+			"apikey_partner2": `sec"ret2`,
+		},
+	}
+	expected := `{"endpoints": [], "extra_config": {"auth/api-keys": {"strategy": "header", "identifier": "X-Api-Key", "keys": [
+		{"@description": "partner1", "key": "secret1", "roles": ["read", "write"]},
+		{"@description": "partner2", "key": "sec\"ret2", "roles": []}]}%s}}`
+
+	for config, rest := range map[string]string{
+		`{"endpoints": [], "extra_config": {"router":{"disable_access_log":true}}}`: `, "router": {"disable_access_log": true}`,
+		`{"endpoints": [], "extra_config": {}}`:                                     ``,
+		`{"endpoints": [], "extra_config": null}`:                                   ``,
+	} {
+		c, err := ApiKeysConfig(config, k)
+		assert.NoError(t, err)
+		fc.config = c
+		out, err := fc.resolve()
+		assert.NoError(t, err)
+		assert.JSONEq(t, fmt.Sprintf(expected, rest), string(out))
+	}
+
+	_, err := ApiKeysConfig(`{"endpoints": []}`, k)
+	assert.ErrorContains(t, err, "no service extra_config")
+
+	config := `{"extra_config": {}}`
+	c, err := ApiKeysConfig(config, &krakendv1.Krakend{})
+	assert.NoError(t, err)
+	assert.Equal(t, config, c)
+}
@@ -0,0 +1,227 @@
+// Package render renders the configuration of a KrakenD instance from a Krakend and its ApiEndpoints
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/helm"
+	"github.com/nais/krakend/internal/krakend"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// EndpointsPartial is the partial of the chart containing the endpoints, which the operator replaces with the index
+// of the partial files of the ApiEndpoints
+const EndpointsPartial = "endpoints.tmpl"
+
+// ConfigFile is the key of the config in the config ConfigMap of the chart, mounted as the config file of KrakenD
+const ConfigFile = "krakend.tmpl"
+
+// flexibleConfig is the flexible configuration of KrakenD as mounted from the ConfigMaps of the chart,
+// see https://www.krakend.io/docs/configuration/flexible-config/
+type flexibleConfig struct {
+	config    string
+	settings  map[string]string
+	partials  map[string]string
+	templates map[string]string
+	env       map[string]string
+}
+
+// KrakendConfig renders the krakend.json of the Krakend with the endpoints of the ApiEndpoints, resolving their auth
+// providers in the Krakend or the catalogue. The chart is rendered as by the operator, and its flexible configuration is
+// resolved as KrakenD does at startup, so the result can be used to run the same configuration in a local KrakenD.
+func KrakendConfig(chart *helm.Chart, k *krakendv1.Krakend, catalogue krakend.AuthProviderCatalogue, list []krakendv1.ApiEndpoints) ([]byte, error) {
+	values, err := ChartValues(k)
+	if err != nil {
+		return nil, fmt.Errorf("preparing values: %w", err)
+	}
+	resources, err := chart.ToUnstructured(k.Name, k.Namespace, chartutil.Values{
+		"krakend": values,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rendering helm chart: %w", err)
+	}
+
+	fc, err := flexibleConfigFrom(resources)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range k.Spec.Deployment.ExtraEnvVars {
+		fc.env[e.Name] = e.Value
+	}
+
+	config, err := IndexedConfig(fc.config)
+	if err != nil {
+		return nil, err
+	}
+	// the keys are in Secrets, like the environment variables from Secrets they render as empty
+	config, err = ApiKeysConfig(config, k)
+	if err != nil {
+		return nil, err
+	}
+	if k.Spec.ApiKeys != nil {
+		for _, key := range k.Spec.ApiKeys.Keys {
+			fc.partials[ApiKeyFile(key)] = ""
+		}
+	}
+	fc.config = config
+
+	// the endpoints are stored as by the operator, a partial file per ApiEndpoints listed in the index
+	files := make(map[string]string)
+	for _, a := range list {
+		content, _, err := EndpointsFileContent(k, catalogue, a)
+		if err != nil {
+			return nil, fmt.Errorf("convert ApiEndpoints to Krakend endpoints: %w", err)
+		}
+		files[EndpointsFile(&a)] = content
+	}
+	index, err := Index(files)
+	if err != nil {
+		return nil, err
+	}
+	for name, content := range files {
+		fc.partials[name] = content
+	}
+	fc.partials[EndpointsIndex] = index
+
+	return fc.resolve()
+}
+
+// flexibleConfigFrom collects the config, settings, partials and templates from the ConfigMaps of the chart,
+// and the environment variables with literal values of the KrakenD container
+func flexibleConfigFrom(resources []*unstructured.Unstructured) (*flexibleConfig, error) {
+	fc := &flexibleConfig{
+		settings:  map[string]string{},
+		partials:  map[string]string{},
+		templates: map[string]string{},
+		env:       map[string]string{},
+	}
+	for _, r := range resources {
+		switch r.GetKind() {
+		case "ConfigMap":
+			data, err := configMapData(r)
+			if err != nil {
+				return nil, err
+			}
+			name := r.GetName()
+			switch {
+			case strings.HasSuffix(name, "-config"):
+				config, ok := data[ConfigFile]
+				if !ok {
+					return nil, fmt.Errorf("ConfigMap '%s' has no %s", name, ConfigFile)
+				}
+				fc.config = config
+			case strings.HasSuffix(name, "-settings"):
+				fc.settings = data
+			case strings.HasSuffix(name, "-partials"):
+				fc.partials = data
+			case strings.HasSuffix(name, "-templates"):
+				fc.templates = data
+			}
+		case "Deployment", "Rollout":
+			// the objects rendered by helm are not deep copyable, e.g. they contain ints, so the fields are read without copying
+			containers, _, _ := unstructured.NestedFieldNoCopy(r.Object, "spec", "template", "spec", "containers")
+			list, ok := containers.([]any)
+			if !ok || len(list) == 0 {
+				continue
+			}
+			container, ok := list[0].(map[string]any)
+			if !ok {
+				continue
+			}
+			env, _ := container["env"].([]any)
+			for _, e := range env {
+				e, ok := e.(map[string]any)
+				if !ok {
+					continue
+				}
+				if name, ok := e["name"].(string); ok {
+					value, _ := e["value"].(string)
+					fc.env[name] = value
+				}
+			}
+		}
+	}
+	if fc.config == "" {
+		return nil, fmt.Errorf("no config found in the ConfigMaps of the chart")
+	}
+	return fc, nil
+}
+
+// configMapData returns the data of the ConfigMap, which is null in the rendered chart if it has no entries
+func configMapData(r *unstructured.Unstructured) (map[string]string, error) {
+	data := make(map[string]string)
+	value, _, _ := unstructured.NestedFieldNoCopy(r.Object, "data")
+	if value == nil {
+		return data, nil
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("reading data of ConfigMap '%s': expected a map, got %T", r.GetName(), value)
+	}
+	for k, v := range m {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("reading data of ConfigMap '%s': expected a string for key '%s', got %T", r.GetName(), k, v)
+		}
+		data[k] = s
+	}
+	return data, nil
+}
+
+// resolve executes the config as a template with the settings as data, as KrakenD does with FC_ENABLE set
+func (fc *flexibleConfig) resolve() ([]byte, error) {
+	data := make(map[string]any)
+	for name, content := range fc.settings {
+		var v any
+		if err := json.Unmarshal([]byte(content), &v); err != nil {
+			return nil, fmt.Errorf("parsing settings '%s': %w", name, err)
+		}
+		data[strings.TrimSuffix(name, filepath.Ext(name))] = v
+	}
+
+	funcs := sprig.TxtFuncMap()
+	funcs["env"] = func(name string) string {
+		return fc.env[name]
+	}
+	funcs["include"] = func(name string) (string, error) {
+		partial, ok := fc.partials[name]
+		if !ok {
+			return "", fmt.Errorf("partial '%s' not found", name)
+		}
+		return partial, nil
+	}
+	funcs["marshal"] = func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+
+	tmpl, err := template.New(ConfigFile).Funcs(funcs).Parse(fc.config)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	for name, content := range fc.templates {
+		if _, err := tmpl.New(name).Parse(content); err != nil {
+			return nil, fmt.Errorf("parsing template '%s': %w", name, err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("executing config: %w", err)
+	}
+
+	// KrakenD only accepts valid JSON, indenting also validates the result
+	out := &bytes.Buffer{}
+	if err := json.Indent(out, buf.Bytes(), "", "  "); err != nil {
+		return nil, fmt.Errorf("config is not valid JSON: %w", err)
+	}
+	return out.Bytes(), nil
+}
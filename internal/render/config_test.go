@@ -0,0 +1,102 @@
+package render
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/helm"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+func TestKrakendConfig(t *testing.T) {
+	k := &krakendv1.Krakend{}
+	assert.NoError(t, parseYaml("testdata/krakend.yaml", k))
+	k.Spec.Deployment.ExtraEnvVars = []corev1.EnvVar{{Name: "SERVICE_NAME", Value: "team1-gateway"}}
+	a := krakendv1.ApiEndpoints{}
+	assert.NoError(t, parseYaml("testdata/apiendpoints.yaml", &a))
+
+	chart, err := helm.LoadChart("../../installer/krakend")
+	assert.NoError(t, err)
+
+	out, err := KrakendConfig(chart, k, nil, []krakendv1.ApiEndpoints{a})
+	assert.NoError(t, err)
+
+	config := make(map[string]any)
+	assert.NoError(t, json.Unmarshal(out, &config))
+	assert.Equal(t, float64(3), config["version"])
+	assert.Equal(t, "team1-gateway (PRODUCTION)", config["name"])
+	// endpoints are defaulted to the service-level timeout of the chart
+	assert.Equal(t, krakendv1.DefaultTimeout, config["timeout"])
+	assert.Contains(t, config["extra_config"], "telemetry/opencensus")
+
+	endpoints := config["endpoints"].([]any)
+	assert.Len(t, endpoints, 2)
+	echo := endpoints[0].(map[string]any)
+	assert.Equal(t, "/echo", echo["endpoint"])
+	assert.Equal(t, krakendv1.DefaultTimeout, echo["timeout"])
+	assert.Contains(t, echo["extra_config"], "auth/validator")
+
+	// the keys are in Secrets, and are empty when rendered outside of KrakenD
+	k.Spec.ApiKeys = &krakendv1.ApiKeys{Keys: []krakendv1.ApiKey{{Name: "partner", Roles: []string{"read"}}}}
+	out, err = KrakendConfig(chart, k, nil, []krakendv1.ApiEndpoints{a})
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(out, &config))
+	assert.Contains(t, config["extra_config"], "telemetry/opencensus")
+	assert.Equal(t, map[string]any{
+		"keys": []any{map[string]any{"@description": "partner", "key": "", "roles": []any{"read"}}},
+	}, config["extra_config"].(map[string]any)["auth/api-keys"])
+}
+
+func TestResolveFlexibleConfig(t *testing.T) {
+	fc := &flexibleConfig{
+		config:    `{"name": "{{ env "NAME" }}", "timeout": "{{ .service.timeout }}", "endpoints": {{ include "endpoints.tmpl" }}, "extra": {{ template "extra.tmpl" . }}}`,
+		settings:  map[string]string{"service.json": `{"timeout": "3s"}`},
+		partials:  map[string]string{"endpoints.tmpl": `[]`},
+		templates: map[string]string{"extra.tmpl": `{{ marshal .service }}`},
+		env:       map[string]string{"NAME": "gw"},
+	}
+	out, err := fc.resolve()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name": "gw", "timeout": "3s", "endpoints": [], "extra": {"timeout": "3s"}}`, string(out))
+
+	fc.partials = map[string]string{}
+	_, err = fc.resolve()
+	assert.ErrorContains(t, err, "partial 'endpoints.tmpl' not found")
+
+	fc.config = `{"endpoints": [}`
+	_, err = fc.resolve()
+	assert.ErrorContains(t, err, "not valid JSON")
+}
+
+func TestFlexibleConfigFrom(t *testing.T) {
+	config := &unstructured.Unstructured{}
+	config.SetKind("ConfigMap")
+	config.SetName("team1-krakend-config")
+	assert.NoError(t, unstructured.SetNestedStringMap(config.Object, map[string]string{
+		"README.md": "not the config",
+		ConfigFile:  `{"version": 3}`,
+	}, "data"))
+
+	// the config is read from its key, other keys are ignored
+	fc, err := flexibleConfigFrom([]*unstructured.Unstructured{config})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version": 3}`, fc.config)
+
+	unstructured.RemoveNestedField(config.Object, "data", ConfigFile)
+	_, err = flexibleConfigFrom([]*unstructured.Unstructured{config})
+	assert.ErrorContains(t, err, "ConfigMap 'team1-krakend-config' has no krakend.tmpl")
+}
+
+func parseYaml(file string, v any) error {
+	reader, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewYAMLOrJSONDecoder(reader, 4096)
+	return decoder.Decode(v)
+}
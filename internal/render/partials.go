@@ -0,0 +1,145 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/krakend"
+)
+
+const (
+	// PartialsSizeLimit is the maximum size of the data of a ConfigMap
+	PartialsSizeLimit = 1024 * 1024
+	// PartialsSizeWarningRatio is the share of the size limit used by the partials at which the operator warns that
+	// the limit is near, it is exported as the partials_warning_bytes metric to alert on the same threshold
+	PartialsSizeWarningRatio = 0.8
+	// EndpointsIndex is the partial listing the partial files of the ApiEndpoints
+	EndpointsIndex = "endpoints_index.json"
+)
+
+// endpointsInclude is the include of the endpoints in the config of the chart
+const endpointsInclude = `{{ include "` + EndpointsPartial + `" }}`
+
+// indexedEndpoints replaces endpointsInclude, it joins the endpoints of the partial files listed in the index into a single list
+const indexedEndpoints = `[{{ $n := 0 }}{{ range include "` + EndpointsIndex + `" | fromJson }}` +
+	`{{ $e := include . | trimPrefix "[" | trimSuffix "]" }}` +
+	`{{ if $e }}{{ if $n }},{{ end }}{{ $e }}{{ $n = add1 $n }}{{ end }}{{ end }}]`
+
+// PartialsName is the name of the partials ConfigMap of the Krakend, as rendered by the chart
+func PartialsName(k *krakendv1.Krakend) string {
+	return fmt.Sprintf("%s-%s-%s", k.Name, "krakend", "partials")
+}
+
+// ConfigName is the name of the config ConfigMap of the Krakend, as rendered by the chart
+func ConfigName(k *krakendv1.Krakend) string {
+	return fmt.Sprintf("%s-%s-%s", k.Name, "krakend", "config")
+}
+
+// ShardName is the name of the shard of the partials ConfigMap of the Krakend, shards are numbered from 1
+func ShardName(k *krakendv1.Krakend, shard int) string {
+	return fmt.Sprintf("%s-%d", PartialsName(k), shard)
+}
+
+// EndpointsFile is the name of the partial file with the endpoints of the ApiEndpoints
+func EndpointsFile(a *krakendv1.ApiEndpoints) string {
+	return fmt.Sprintf("apiendpoints_%s.json", a.Name)
+}
+
+// IsEndpointsFile returns true if the partial is the file of an ApiEndpoints
+func IsEndpointsFile(name string) bool {
+	return strings.HasPrefix(name, "apiendpoints_") && strings.HasSuffix(name, ".json")
+}
+
+// IndexedConfig returns the config of the chart with the endpoints read from the partial files listed in the index
+func IndexedConfig(config string) (string, error) {
+	if !strings.Contains(config, endpointsInclude) {
+		return "", fmt.Errorf("config does not include the endpoints with %s", endpointsInclude)
+	}
+	return strings.Replace(config, endpointsInclude, indexedEndpoints, 1), nil
+}
+
+// EndpointsFileContent renders the endpoints of the ApiEndpoints into the content of its partial file, and returns it
+// with the number of endpoints
+func EndpointsFileContent(k *krakendv1.Krakend, catalogue krakend.AuthProviderCatalogue, a krakendv1.ApiEndpoints) (string, int, error) {
+	endpoints, err := krakend.ToKrakendEndpoints(k, catalogue, []krakendv1.ApiEndpoints{a})
+	if err != nil {
+		return "", 0, err
+	}
+	content, err := json.Marshal(endpoints)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(content), len(endpoints), nil
+}
+
+// Index returns the index of the partial files, in order of file name
+func Index(files map[string]string) (string, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	index, err := json.Marshal(names)
+	if err != nil {
+		return "", err
+	}
+	return string(index), nil
+}
+
+// Shard assigns the partial files to the given number of shards, each within PartialsSizeLimit. Files stay in the shard
+// they are in, given by current as a shard index per file name, as long as they fit, so updating an ApiEndpoints only
+// changes the shard with its file. The data of each shard is returned in order.
+func Shard(files map[string]string, shards int, current map[string]int) ([]map[string]string, error) {
+	data := make([]map[string]string, shards)
+	sizes := make([]int, shards)
+	for i := range data {
+		data[i] = make(map[string]string)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	unassigned := make([]string, 0)
+	for _, name := range names {
+		i, ok := current[name]
+		size := len(files[name])
+		if ok && i >= 0 && i < shards && sizes[i]+size <= PartialsSizeLimit {
+			data[i][name] = files[name]
+			sizes[i] += size
+			continue
+		}
+		unassigned = append(unassigned, name)
+	}
+
+	for _, name := range unassigned {
+		size := len(files[name])
+		assigned := false
+		for i := range data {
+			if sizes[i]+size <= PartialsSizeLimit {
+				data[i][name] = files[name]
+				sizes[i] += size
+				assigned = true
+				break
+			}
+		}
+		if !assigned {
+			return nil, fmt.Errorf("partial file '%s' of %d bytes does not fit in any of the %d shards of %d bytes", name, size, shards, PartialsSizeLimit)
+		}
+	}
+	return data, nil
+}
+
+// DataSize returns the size of the data of a ConfigMap, as counted by the API server against PartialsSizeLimit
+func DataSize(data map[string]string) int {
+	size := 0
+	for _, v := range data {
+		size += len(v)
+	}
+	return size
+}
@@ -0,0 +1,65 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShard(t *testing.T) {
+	quarter := strings.Repeat("x", PartialsSizeLimit/4)
+	files := map[string]string{
+		"apiendpoints_a.json": quarter,
+		"apiendpoints_b.json": quarter,
+		"apiendpoints_c.json": quarter,
+		"apiendpoints_d.json": "[]",
+	}
+
+	data, err := Shard(files, 2, nil)
+	assert.NoError(t, err)
+	assert.Len(t, data, 2)
+	assert.Len(t, data[0], 4)
+	assert.Empty(t, data[1])
+
+	// files stay in their current shard, and files which no longer fit are moved to the first shard with room
+	data, err = Shard(files, 2, map[string]int{"apiendpoints_a.json": 1, "apiendpoints_b.json": 1})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"apiendpoints_c.json", "apiendpoints_d.json"}, keys(data[0]))
+	assert.ElementsMatch(t, []string{"apiendpoints_a.json", "apiendpoints_b.json"}, keys(data[1]))
+
+	files["apiendpoints_e.json"] = strings.Repeat("x", PartialsSizeLimit/2+1)
+	files["apiendpoints_f.json"] = strings.Repeat("x", PartialsSizeLimit/2+1)
+	_, err = Shard(files, 2, nil)
+	assert.ErrorContains(t, err, "partial file 'apiendpoints_f.json'")
+}
+
+func TestIndexedConfig(t *testing.T) {
+	fc := &flexibleConfig{
+		config: `{"endpoints": {{ include "endpoints.tmpl" }}}`,
+		partials: map[string]string{
+			EndpointsIndex:        `["apiendpoints_a.json", "apiendpoints_b.json", "apiendpoints_c.json"]`,
+			"apiendpoints_a.json": `[{"endpoint": "/a"}]`,
+			"apiendpoints_b.json": `[]`,
+			"apiendpoints_c.json": `[{"endpoint": "/c1"},{"endpoint": "/c2"}]`,
+		},
+	}
+	config, err := IndexedConfig(fc.config)
+	assert.NoError(t, err)
+	fc.config = config
+
+	out, err := fc.resolve()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"endpoints": [{"endpoint": "/a"}, {"endpoint": "/c1"}, {"endpoint": "/c2"}]}`, string(out))
+
+	_, err = IndexedConfig(`{"endpoints": []}`)
+	assert.ErrorContains(t, err, "does not include the endpoints")
+}
+
+func keys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,57 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+)
+
+// ChartValues returns the values of the KrakenD chart for the Krakend
+func ChartValues(k *krakendv1.Krakend) (map[string]any, error) {
+	values, err := toMap(k.Spec.Deployment)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling krakend deployment: %w", err)
+	}
+
+	ingress := k.Spec.Ingress
+	ingressHost := k.Spec.IngressHost
+	if len(ingress.Hosts) == 0 && ingressHost == "" {
+		return nil, fmt.Errorf("either ingressHost or ingress.hosts must be specified")
+	}
+
+	if len(ingress.Hosts) == 0 && ingressHost != "" {
+		ingress.Hosts = []krakendv1.Host{
+			{
+				Host: ingressHost,
+				Paths: []krakendv1.Path{
+					{
+						Path:     "/",
+						PathType: "ImplementationSpecific",
+					},
+				},
+			},
+		}
+	}
+	ingressValues, err := toMap(ingress)
+	if err != nil {
+		return nil, fmt.Errorf("preparing ingress values: %w", err)
+	}
+
+	values["ingress"] = ingressValues
+
+	return values, nil
+}
+
+func toMap(v any) (map[string]any, error) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]any)
+	err = json.Unmarshal(j, &m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
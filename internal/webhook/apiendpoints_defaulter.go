@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+	log "github.com/sirupsen/logrus"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/mutate-apiendpoints,mutating=true,failurePolicy=fail,sideEffects=None,groups=krakend.nais.io,resources=apiendpoints,verbs=create;update,versions=v1,name=mapiendpoints.krakend.nais.io,admissionReviewVersions=v1
+
+// ApiEndpointsDefaulter sets the defaults of ApiEndpoints, see krakendv1.ApiEndpoints.Default
+type ApiEndpointsDefaulter struct {
+	decoder *admission.Decoder
+}
+
+func (d *ApiEndpointsDefaulter) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	log.Infof("registering webhook server at /mutate-apiendpoints")
+	d.decoder = admission.NewDecoder(mgr.GetScheme())
+	mgr.GetWebhookServer().Register("/mutate-apiendpoints", &webhook.Admission{Handler: d})
+	return nil
+}
+
+func (d *ApiEndpointsDefaulter) Handle(_ context.Context, req admission.Request) admission.Response {
+	a := &krakendv1.ApiEndpoints{}
+	err := d.decoder.Decode(req, a)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if a.GetDeletionTimestamp() != nil {
+		return admission.Allowed("")
+	}
+
+	a.Default()
+
+	defaulted, err := json.Marshal(a)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, defaulted)
+}
@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nais/krakend/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("ApiEndpoints Mutating Webhook", func() {
+	It("should store the defaulted ApiEndpoints", func() {
+		k := validKrakend("default", "default")
+		Expect(k8sClient.Create(ctx, k)).Should(Succeed())
+
+		spec := newApiEndpointSpec(paths("defaulted/"))
+		spec.Krakend = ""
+		spec.Endpoints[0].Method = ""
+		created := apiEndpoints("defaulted", "default", spec)
+		Expect(k8sClient.Create(ctx, created)).Should(Succeed())
+
+		fetched := &v1.ApiEndpoints{}
+		Expect(k8sClient.Get(ctx, nname(created), fetched)).Should(Succeed())
+		Expect(fetched.Spec.Krakend).Should(Equal("default"))
+		Expect(fetched.Spec.Endpoints[0].Path).Should(Equal("/defaulted"))
+		Expect(fetched.Spec.Endpoints[0].Method).Should(Equal(v1.DefaultMethod))
+		Expect(fetched.Spec.Endpoints[0].TimeOut).Should(Equal(v1.DefaultTimeout))
+
+		Expect(k8sClient.Delete(ctx, created)).Should(Succeed())
+		Expect(k8sClient.Delete(ctx, k)).Should(Succeed())
+	})
+})
+
+func TestApiEndpointsDefaulter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, v1.AddToScheme(scheme))
+	d := &ApiEndpointsDefaulter{decoder: admission.NewDecoder(scheme)}
+
+	a := &v1.ApiEndpoints{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1.GroupVersion.String(), Kind: "ApiEndpoints"},
+		ObjectMeta: metav1.ObjectMeta{Name: "app1", Namespace: "ns1"},
+		Spec: v1.ApiEndpointsSpec{
+			Endpoints: []v1.Endpoint{
+				{Path: "app1/", BackendHost: "http://app1", BackendPath: "app1/"},
+				{Path: "/", Method: "post", TimeOut: "10s", BackendHost: "http://app1", BackendPath: "/"},
+			},
+			OpenEndpoints: []v1.Endpoint{
+				{Path: "/doc/", Backends: []v1.Backend{{Hosts: []string{"http://app1"}, Path: "doc"}}},
+			},
+		},
+	}
+	raw, err := json.Marshal(a)
+	assert.NoError(t, err)
+
+	resp := d.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}})
+	assert.True(t, resp.Allowed)
+
+	patched := make(map[string]any)
+	for _, p := range resp.Patches {
+		patched[p.Path] = p.Value
+	}
+	assert.Equal(t, "ns1", patched["/spec/krakend"])
+	assert.Equal(t, "/app1", patched["/spec/endpoints/0/path"])
+	assert.Equal(t, "GET", patched["/spec/endpoints/0/method"])
+	assert.Equal(t, v1.DefaultTimeout, patched["/spec/endpoints/0/timeout"])
+	assert.Equal(t, "/app1/", patched["/spec/endpoints/0/backendPath"])
+	assert.Equal(t, "POST", patched["/spec/endpoints/1/method"])
+	assert.NotContains(t, patched, "/spec/endpoints/1/path")
+	assert.NotContains(t, patched, "/spec/endpoints/1/timeout")
+	assert.Equal(t, "/doc", patched["/spec/openEndpoints/0/path"])
+	assert.Equal(t, "/doc", patched["/spec/openEndpoints/0/backends/0/path"])
+}
@@ -2,14 +2,21 @@ package webhook
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
 
 	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/krakend"
 	log "github.com/sirupsen/logrus"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -19,13 +26,30 @@ import (
 const (
 	MsgKrakendDoesNotExist = "the referenced Krakend does not exist"
 	MsgPathDuplicate       = "duplicate paths in apiendpoints resource"
+	MsgAuthOnOpenEndpoint  = "auth is not supported for openEndpoints"
+	MsgApiKeysMissing      = "the Krakend has no apiKeys"
+
+	RateLimitStrategyIp     = "ip"
+	RateLimitStrategyHeader = "header"
+
+	ScopesMatcherAny = "any"
+	ScopesMatcherAll = "all"
+)
+
+var (
+	// SupportedMethods are the HTTP methods supported by KrakenD endpoints
+	SupportedMethods = sets.New("GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS")
+
+	placeholderPattern = regexp.MustCompile(`\{([^{}]+)\}`)
 )
 
 //+kubebuilder:webhook:path=/validate-apiendpoints,mutating=false,failurePolicy=fail,sideEffects=None,groups=krakend.nais.io,resources=apiendpoints,verbs=create;update,versions=v1,name=apiendpoints.krakend.nais.io,admissionReviewVersions=v1
 
 type ApiEndpointsValidator struct {
-	client  client.Client
-	decoder *admission.Decoder
+	// AuthProviders is the catalogue of auth providers available to the ApiEndpoints of all Krakends
+	AuthProviders krakend.AuthProviderCatalogue
+	client        client.Client
+	decoder       *admission.Decoder
 }
 
 func (v *ApiEndpointsValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
@@ -45,107 +69,329 @@ func (v *ApiEndpointsValidator) Handle(ctx context.Context, req admission.Reques
 	if a.GetDeletionTimestamp() != nil {
 		return admission.Allowed("")
 	}
-	if err := v.validate(ctx, a); err != nil {
-		return admission.Denied(err.Error())
+	denials, err := v.validate(ctx, a)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(denials) > 0 {
+		recordDenial("apiendpoints", denials)
+		return admission.Denied(denials.ErrorList().ToAggregate().Error())
 	}
 	return admission.Allowed("")
 }
 
-func (v *ApiEndpointsValidator) validate(ctx context.Context, a *krakendv1.ApiEndpoints) error {
+// validate returns the violations of the ApiEndpoints, or an error if they could not be determined
+func (v *ApiEndpointsValidator) validate(ctx context.Context, a *krakendv1.ApiEndpoints) (Denials, error) {
 	k := &krakendv1.Krakend{}
 
-	krakendName := a.Spec.Krakend
-	if krakendName == "" {
-		krakendName = a.Namespace
-	}
-
 	err := v.client.Get(ctx, types.NamespacedName{
-		Name:      krakendName,
+		Name:      a.KrakendName(),
 		Namespace: a.Namespace,
 	}, k)
 	if client.IgnoreNotFound(err) != nil {
-		return fmt.Errorf("getting krakendinstance: %w", err)
+		return nil, fmt.Errorf("getting krakendinstance: %w", err)
 	}
 	if apierrors.IsNotFound(err) {
-		return errors.New(MsgKrakendDoesNotExist)
+		return deny(krakendv1.ReasonKrakendNotFound, field.Invalid(field.NewPath("spec", "krakend"), a.KrakendName(), MsgKrakendDoesNotExist)), nil
 	}
 	log.Infof("found krakendinstance %s", k.Name)
 
-	err = validateAuth(k, a.Spec.Auth)
-	if err != nil {
-		return err
-	}
-
 	el := &krakendv1.ApiEndpointsList{}
 	err = v.client.List(ctx, el, client.InNamespace(k.Namespace))
 	if err != nil {
-		return fmt.Errorf("getting list of apiendpoints: %w", err)
+		return nil, fmt.Errorf("getting list of apiendpoints: %w", err)
 	}
-	return validateEndpointsList(el, a)
+	return ValidateApiEndpoints(k, v.AuthProviders, a, el), nil
 }
 
-func validateAuth(k *krakendv1.Krakend, auth krakendv1.Auth) error {
-	found := false
-	for _, p := range k.Spec.AuthProviders {
-		if p.Name == auth.Name {
-			found = true
-			break
-		}
+// ValidateApiEndpoints validates the ApiEndpoints against the Krakend it targets, the catalogue of auth providers and the
+// existing ApiEndpoints in the namespace
+func ValidateApiEndpoints(k *krakendv1.Krakend, catalogue krakend.AuthProviderCatalogue, a *krakendv1.ApiEndpoints, el *krakendv1.ApiEndpointsList) Denials {
+	specPath := field.NewPath("spec")
+	denials := deny(krakendv1.ReasonInvalidSpec, validateApiEndpointsSpec(a.Spec)...)
+
+	denials = append(denials, validateAuthSpec(k, catalogue, specPath.Child("auth"), a.Spec.Auth)...)
+	denials = append(denials, validateEndpointAuth(k, catalogue, a.Spec)...)
+
+	if err := validateEndpointsList(el, a); err != nil {
+		denials = append(denials, deny(ReasonPathConflict, field.Forbidden(specPath, err.Error()))...)
 	}
-	if !found {
+	return denials
+}
+
+// validateAuth requires the auth provider to be defined in the Krakend or in the auth provider catalogue
+func validateAuth(k *krakendv1.Krakend, catalogue krakend.AuthProviderCatalogue, auth krakendv1.Auth) error {
+	if _, ok := catalogue.Lookup(k, auth.Name); !ok {
 		return fmt.Errorf("auth provider %s not found in krakendinstance %s", auth.Name, k.Name)
 	}
 	return nil
 }
 
-func validateEndpointsList(el *krakendv1.ApiEndpointsList, e *krakendv1.ApiEndpoints) error {
-	endpointUpdated := false
-	for i := len(el.Items) - 1; i >= 0; i-- {
-		endpoint := el.Items[i]
-		// Delete the apiEndpoints that is about to be updated from existing list
-		if endpoint.Name == e.Name {
-			el.Items = append(el.Items[:i], el.Items[i+1:]...)
-			//add new apiEndpoints to list
-			el.Items = append(el.Items, *e)
-			endpointUpdated = true
+// validateAuthSpec validates the JWT auth with an auth provider, or the auth with the API keys of the Krakend
+func validateAuthSpec(k *krakendv1.Krakend, catalogue krakend.AuthProviderCatalogue, path *field.Path, auth krakendv1.Auth) Denials {
+	denials := Denials{}
+	errs := field.ErrorList{}
+	if auth.ApiKeys != nil {
+		apiKeysPath := path.Child("apiKeys")
+		if k.Spec.ApiKeys == nil {
+			denials = append(denials, deny(krakendv1.ReasonAuthProviderNotFound, field.Forbidden(apiKeysPath, fmt.Sprintf("%s: %s", MsgApiKeysMissing, k.Name)))...)
+		}
+		if len(auth.ApiKeys.Roles) == 0 {
+			errs = append(errs, field.Required(apiKeysPath.Child("roles"), ""))
+		}
+		if auth.Name != "" {
+			errs = append(errs, field.Forbidden(apiKeysPath, "apiKeys and name are mutually exclusive"))
+		}
+		if len(auth.RequireClaims) > 0 || !reflect.DeepEqual(auth.Claims, krakendv1.Claims{}) {
+			errs = append(errs, field.Forbidden(apiKeysPath, "claim settings are only supported for JWT auth"))
+		}
+		return append(denials, deny(krakendv1.ReasonInvalidSpec, errs...)...)
+	}
+
+	if err := validateAuth(k, catalogue, auth); err != nil {
+		denials = append(denials, deny(krakendv1.ReasonAuthProviderNotFound, field.Invalid(path.Child("name"), auth.Name, err.Error()))...)
+	} else if krakend.RequiresAudience(auth.Name) && len(auth.Audience) == 0 {
+		errs = append(errs, field.Required(path.Child("audience"), fmt.Sprintf("%s issues tokens for any application, the audience of the API is required", auth.Name)))
+	}
+	errs = append(errs, validateClaims(path, auth.Claims)...)
+	errs = append(errs, validateRequireClaims(path.Child("requireClaims"), auth.RequireClaims)...)
+	return append(denials, deny(krakendv1.ReasonInvalidSpec, errs...)...)
+}
+
+// validateEndpointAuth validates the auth overrides of the individual endpoints
+func validateEndpointAuth(k *krakendv1.Krakend, catalogue krakend.AuthProviderCatalogue, spec krakendv1.ApiEndpointsSpec) Denials {
+	denials := Denials{}
+	for i, e := range spec.Endpoints {
+		if e.Auth == nil {
+			continue
+		}
+		denials = append(denials, validateAuthSpec(k, catalogue, field.NewPath("spec", "endpoints").Index(i).Child("auth"), *e.Auth)...)
+	}
+	for i, e := range spec.OpenEndpoints {
+		if e.Auth != nil {
+			denials = append(denials, deny(krakendv1.ReasonInvalidSpec, field.Forbidden(field.NewPath("spec", "openEndpoints").Index(i).Child("auth"), MsgAuthOnOpenEndpoint))...)
+		}
+	}
+	return denials
+}
+
+// validateClaims validates the claim settings of an auth provider or the auth of ApiEndpoints
+func validateClaims(path *field.Path, c krakendv1.Claims) field.ErrorList {
+	errs := field.ErrorList{}
+	switch c.ScopesMatcher {
+	case "", ScopesMatcherAny, ScopesMatcherAll:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("scopesMatcher"), c.ScopesMatcher, []string{ScopesMatcherAny, ScopesMatcherAll}))
+	}
+
+	headers := sets.New[string]()
+	for i, p := range c.PropagateClaims {
+		claimPath := path.Child("propagateClaims").Index(i)
+		if p.Claim == "" {
+			errs = append(errs, field.Required(claimPath.Child("claim"), ""))
+		}
+		if p.Header == "" {
+			errs = append(errs, field.Required(claimPath.Child("header"), ""))
+			continue
+		}
+		for _, msg := range validation.IsHTTPHeaderName(p.Header) {
+			errs = append(errs, field.Invalid(claimPath.Child("header"), p.Header, msg))
+		}
+		// header names are case-insensitive
+		header := http.CanonicalHeaderKey(p.Header)
+		if headers.Has(header) {
+			errs = append(errs, field.Duplicate(claimPath.Child("header"), p.Header))
+		}
+		headers.Insert(header)
+	}
+	return errs
+}
+
+// validateRequireClaims validates the syntax of the rules on the claims of the JWT
+func validateRequireClaims(path *field.Path, rules []string) field.ErrorList {
+	errs := field.ErrorList{}
+	for i, rule := range rules {
+		if _, err := krakend.ParseClaimRule(rule); err != nil {
+			errs = append(errs, field.Invalid(path.Index(i), rule, err.Error()))
 		}
 	}
-	if !endpointUpdated {
-		el.Items = append(el.Items, *e)
+	return errs
+}
+
+func validateEndpointsList(el *krakendv1.ApiEndpointsList, e *krakendv1.ApiEndpoints) error {
+	// only endpoints in the same Krakend share a router
+	items := make([]krakendv1.ApiEndpoints, 0)
+	for _, endpoint := range el.Items {
+		// the apiEndpoints that is about to be updated is replaced by the new version
+		if endpoint.Name != e.Name && endpoint.KrakendName() == e.KrakendName() {
+			items = append(items, endpoint)
+		}
 	}
+	list := &krakendv1.ApiEndpointsList{Items: append(items, *e)}
 
-	err := uniquePaths(el)
+	err := uniquePaths(list)
 	if err != nil {
-		return errors.New(MsgPathDuplicate)
+		return fmt.Errorf("%s: %w", MsgPathDuplicate, err)
 	}
 	return nil
 }
 
+// uniquePaths returns an error if any endpoints in the list have the same method and path, or cannot be registered in the KrakenD router together
 func uniquePaths(list *krakendv1.ApiEndpointsList) error {
-	paths := make(map[string]string)
+	routes := make([]route, 0)
 	for _, e := range list.Items {
-		if e.GetDeletionTimestamp() == nil {
-			if len(e.Spec.Endpoints) > 0 {
-				for _, p := range e.Spec.Endpoints {
-					if _, ok := paths[p.Path]; ok {
-						log.Warnf("duplicate path %s in endpoints %s and %s", p.Path, e.Name, paths[p.Path])
-						return fmt.Errorf("duplicate path %s in endpoints %s and %s", p.Path, e.Name, paths[p.Path])
-					} else {
-						paths[p.Path] = e.Name
-					}
-				}
-			}
-			if len(e.Spec.OpenEndpoints) > 0 {
-				for _, p := range e.Spec.OpenEndpoints {
-					if _, ok := paths[p.Path]; ok {
-						log.Warnf("duplicate path %s in openEndpoints %s and %s", p.Path, e.Name, paths[p.Path])
-						return fmt.Errorf("duplicate path %s in endpoints %s and %s", p.Path, e.Name, paths[p.Path])
-					} else {
-						paths[p.Path] = e.Name
-					}
+		if e.GetDeletionTimestamp() != nil {
+			continue
+		}
+		endpoints := append(append([]krakendv1.Endpoint{}, e.Spec.Endpoints...), e.Spec.OpenEndpoints...)
+		for _, p := range endpoints {
+			r := newRoute(p, e.Name)
+			for _, existing := range routes {
+				if err := r.conflicts(existing); err != nil {
+					log.Warnf("path conflict: %v", err)
+					return err
 				}
 			}
+			routes = append(routes, r)
+		}
+	}
+	return nil
+}
+
+// validateApiEndpointsSpec validates the endpoints and rate limits of the spec, which would otherwise only fail when loaded by KrakenD
+func validateApiEndpointsSpec(spec krakendv1.ApiEndpointsSpec) field.ErrorList {
+	errs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	errs = append(errs, validateRateLimit(specPath.Child("rateLimit"), spec.RateLimit)...)
+	errs = append(errs, validateBackendRateLimit(specPath.Child("backendRateLimit"), spec.BackendRateLimit)...)
+	errs = append(errs, validateCircuitBreaker(specPath.Child("circuitBreaker"), spec.CircuitBreaker)...)
+	for i, e := range spec.Endpoints {
+		errs = append(errs, validateEndpoint(specPath.Child("endpoints").Index(i), e)...)
+	}
+	for i, e := range spec.OpenEndpoints {
+		errs = append(errs, validateEndpoint(specPath.Child("openEndpoints").Index(i), e)...)
+	}
+	return errs
+}
+
+func validateEndpoint(path *field.Path, e krakendv1.Endpoint) field.ErrorList {
+	errs := field.ErrorList{}
+
+	errs = append(errs, validateMethod(path.Child("method"), e.Method)...)
+	if e.TimeOut != "" {
+		if _, err := time.ParseDuration(e.TimeOut); err != nil {
+			errs = append(errs, field.Invalid(path.Child("timeout"), e.TimeOut, "must be a valid duration, e.g. 2s or 500ms"))
 		}
 	}
+	errs = append(errs, validateRateLimit(path.Child("rateLimit"), e.RateLimit)...)
+	errs = append(errs, validateBackendRateLimit(path.Child("backendRateLimit"), e.BackendRateLimit)...)
+	errs = append(errs, validateCircuitBreaker(path.Child("circuitBreaker"), e.CircuitBreaker)...)
+
+	if len(e.Backends) == 0 {
+		errs = append(errs, validateBackendHost(path.Child("backendHost"), e.BackendHost)...)
+		errs = append(errs, validatePlaceholders(path.Child("backendPath"), e.BackendPath, e.Path)...)
+		return errs
+	}
+	for i, b := range e.Backends {
+		backendPath := path.Child("backends").Index(i)
+		if len(b.Hosts) == 0 {
+			errs = append(errs, field.Required(backendPath.Child("hosts"), "at least one host is required"))
+		}
+		for j, h := range b.Hosts {
+			errs = append(errs, validateBackendHost(backendPath.Child("hosts").Index(j), h)...)
+		}
+		errs = append(errs, validateMethod(backendPath.Child("method"), b.Method)...)
+		errs = append(errs, validatePlaceholders(backendPath.Child("path"), b.Path, e.Path)...)
+	}
+	return errs
+}
+
+func validateMethod(path *field.Path, method string) field.ErrorList {
+	if method == "" || SupportedMethods.Has(strings.ToUpper(method)) {
+		return nil
+	}
+	return field.ErrorList{field.NotSupported(path, method, sets.List(SupportedMethods))}
+}
+
+// validateBackendHost requires the host to include the scheme, as KrakenD does not add one
+func validateBackendHost(path *field.Path, host string) field.ErrorList {
+	if err := validateUrl(host); err != nil {
+		return field.ErrorList{field.Invalid(path, host, err.Error())}
+	}
 	return nil
 }
+
+// validatePlaceholders requires the placeholders of the backend path, e.g. {id}, to be defined in the endpoint path
+func validatePlaceholders(path *field.Path, backendPath, endpointPath string) field.ErrorList {
+	errs := field.ErrorList{}
+	defined := sets.New[string]()
+	for _, m := range placeholderPattern.FindAllStringSubmatch(endpointPath, -1) {
+		defined.Insert(m[1])
+	}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(backendPath, -1) {
+		// claims of the validated token are available to the backend path as {JWT.<claim>}
+		if strings.HasPrefix(m[1], "JWT.") {
+			continue
+		}
+		if !defined.Has(m[1]) {
+			errs = append(errs, field.Invalid(path, backendPath, fmt.Sprintf("placeholder %s is not defined in path %s", m[0], endpointPath)))
+		}
+	}
+	return errs
+}
+
+func validateRateLimit(path *field.Path, r *krakendv1.RateLimit) field.ErrorList {
+	if r == nil || r.Disabled {
+		return nil
+	}
+	errs := field.ErrorList{}
+	switch r.Strategy {
+	case "", RateLimitStrategyIp:
+	case RateLimitStrategyHeader:
+		if r.Key == "" {
+			errs = append(errs, field.Required(path.Child("key"), "key is required when strategy is header"))
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("strategy"), r.Strategy, []string{RateLimitStrategyIp, RateLimitStrategyHeader}))
+	}
+	return errs
+}
+
+// validateBackendRateLimit requires a positive rate, KrakenD would otherwise not send any requests to the backends
+func validateBackendRateLimit(path *field.Path, r *krakendv1.BackendRateLimit) field.ErrorList {
+	if r == nil || r.Disabled {
+		return nil
+	}
+	errs := field.ErrorList{}
+	if r.MaxRate <= 0 {
+		errs = append(errs, field.Invalid(path.Child("maxRate"), r.MaxRate, "must be greater than 0"))
+	}
+	if r.Capacity < 0 {
+		errs = append(errs, field.Invalid(path.Child("capacity"), r.Capacity, "must not be negative"))
+	}
+	if r.Every != "" {
+		if d, err := time.ParseDuration(r.Every); err != nil || d <= 0 {
+			errs = append(errs, field.Invalid(path.Child("every"), r.Every, "must be a positive duration, e.g. 1s or 1m"))
+		}
+	}
+	return errs
+}
+
+// validateCircuitBreaker requires the settings of the circuit breaker to be positive, as KrakenD has no defaults for them
+func validateCircuitBreaker(path *field.Path, c *krakendv1.CircuitBreaker) field.ErrorList {
+	if c == nil || c.Disabled {
+		return nil
+	}
+	errs := field.ErrorList{}
+	if c.Interval <= 0 {
+		errs = append(errs, field.Invalid(path.Child("interval"), c.Interval, "must be greater than 0"))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, field.Invalid(path.Child("timeout"), c.Timeout, "must be greater than 0"))
+	}
+	if c.MaxErrors <= 0 {
+		errs = append(errs, field.Invalid(path.Child("maxErrors"), c.MaxErrors, "must be greater than 0"))
+	}
+	return errs
+}
@@ -2,11 +2,13 @@ package webhook
 
 import (
 	"github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/krakend"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/assert"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"os"
 	"testing"
@@ -22,20 +24,7 @@ var _ = Describe("ApiEndpoints Validating Webhook", func() {
 	ns := "default"
 
 	BeforeEach(func() {
-		k = &v1.Krakend{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "default",
-				Namespace: "default",
-			},
-			Spec: v1.KrakendSpec{
-				AuthProviders: []v1.AuthProvider{
-					{
-						Name: "maskinporten",
-					},
-				},
-			},
-			Status: v1.KrakendStatus{},
-		}
+		k = validKrakend("default", "default")
 		a = &v1.ApiEndpoints{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      "existing",
@@ -87,7 +76,7 @@ var _ = Describe("ApiEndpoints Validating Webhook", func() {
 		})
 
 		It("should fail to create if krakendinstance does not exist", func() {
-			spec := newApiEndpointSpec(krakend("doesnotexist"))
+			spec := newApiEndpointSpec(krakendName("doesnotexist"))
 			created = apiEndpoints(name, ns, spec)
 
 			By("creating a valid apiendpoints resource where krakendinstance does not exist")
@@ -107,6 +96,26 @@ var _ = Describe("ApiEndpoints Validating Webhook", func() {
 			Expect(k8sClient.Delete(ctx, created)).Should(Not(Succeed()))
 		})
 
+		It("should report all invalid endpoint fields at once", func() {
+			spec := newApiEndpointSpec(paths("/invalid"))
+			spec.Endpoints[0].BackendHost = "host1"
+			spec.Endpoints[0].TimeOut = "forever"
+			created = apiEndpoints(name, ns, spec)
+
+			err := k8sClient.Create(ctx, created)
+			Expect(err).Should(MatchError(ContainSubstring("spec.endpoints[0].backendHost")))
+			Expect(err).Should(MatchError(ContainSubstring("spec.endpoints[0].timeout")))
+		})
+
+		It("should fail to create an object with a path conflicting with another apiendpoints object", func() {
+			existing := apiEndpoints("existing-params", ns, newApiEndpointSpec(paths("/params/{id}")))
+			Expect(k8sClient.Create(ctx, existing)).Should(Succeed())
+
+			created = apiEndpoints(name, ns, newApiEndpointSpec(paths("/params/{name}/details")))
+			Expect(k8sClient.Create(ctx, created)).Should(MatchError(ContainSubstring(MsgPathDuplicate)))
+			Expect(k8sClient.Delete(ctx, existing)).Should(Succeed())
+		})
+
 		It("should fail to create object if auth provider does not exist", func() {
 			spec := newApiEndpointSpec(auth("doesnotexist"))
 			created = apiEndpoints(name, ns, spec)
@@ -163,6 +172,203 @@ func TestValidateEndpointsList(t *testing.T) {
 
 }
 
+func TestValidateEndpointAuth(t *testing.T) {
+	k := &v1.Krakend{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: v1.KrakendSpec{
+			AuthProviders: []v1.AuthProvider{
+				{Name: "maskinporten"},
+				{Name: "azuread"},
+			},
+		},
+	}
+
+	spec := newApiEndpointSpec(paths("/admin"))
+	spec.Endpoints[0].Auth = &v1.Auth{Name: "azuread", Scope: []string{"admin"}}
+	assert.NoError(t, validateEndpointAuth(k, nil, spec).ErrorList().ToAggregate())
+
+	spec.Endpoints[0].Auth = &v1.Auth{Name: "doesnotexist"}
+	assert.Error(t, validateEndpointAuth(k, nil, spec).ErrorList().ToAggregate())
+
+	spec = newApiEndpointSpec()
+	spec.OpenEndpoints = []v1.Endpoint{
+		{Path: "/open", Auth: &v1.Auth{Name: "maskinporten"}},
+	}
+	err := validateEndpointAuth(k, nil, spec).ErrorList().ToAggregate()
+	assert.ErrorContains(t, err, MsgAuthOnOpenEndpoint)
+}
+
+func TestValidateAuthAudienceRequired(t *testing.T) {
+	k := &v1.Krakend{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+	catalogue := krakend.AuthProviderCatalogue{{Name: "tokenx"}, {Name: "maskinporten"}}
+	path := field.NewPath("spec", "auth")
+
+	// tokens of tokenx are issued for any application, so the audience of the API is required
+	denials := validateAuthSpec(k, catalogue, path, v1.Auth{Name: "tokenx"})
+	assert.Equal(t, field.ErrorList{field.Required(path.Child("audience"), "tokenx issues tokens for any application, the audience of the API is required")}, denials.ErrorList())
+	assert.Equal(t, []string{v1.ReasonInvalidSpec}, denials.Reasons())
+
+	assert.Empty(t, validateAuthSpec(k, catalogue, path, v1.Auth{Name: "tokenx", Audience: []string{"dev-gcp:team1:app1"}}))
+	assert.Empty(t, validateAuthSpec(k, catalogue, path, v1.Auth{Name: "maskinporten"}))
+}
+
+func TestValidateApiKeysAuth(t *testing.T) {
+	k := &v1.Krakend{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: v1.KrakendSpec{
+			AuthProviders: []v1.AuthProvider{{Name: "maskinporten"}},
+		},
+	}
+	path := field.NewPath("spec", "auth")
+	auth := v1.Auth{ApiKeys: &v1.ApiKeysAuth{Roles: []string{"read"}}}
+
+	errs := validateAuthSpec(k, nil, path, auth)
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Detail, MsgApiKeysMissing)
+	assert.Equal(t, []string{v1.ReasonAuthProviderNotFound}, errs.Reasons())
+
+	k.Spec.ApiKeys = &v1.ApiKeys{Keys: []v1.ApiKey{{Name: "partner", Roles: []string{"read"}}}}
+	assert.Empty(t, validateAuthSpec(k, nil, path, auth))
+
+	auth = v1.Auth{
+		Name:          "maskinporten",
+		ApiKeys:       &v1.ApiKeysAuth{},
+		RequireClaims: []string{`consumer.ID == "0192:889640782"`},
+	}
+	fields := make([]string, 0)
+	for _, err := range validateAuthSpec(k, nil, path, auth) {
+		fields = append(fields, err.Field)
+	}
+	assert.Equal(t, []string{"spec.auth.apiKeys.roles", "spec.auth.apiKeys", "spec.auth.apiKeys"}, fields)
+
+	spec := newApiEndpointSpec(paths("/partner"))
+	spec.Endpoints[0].Auth = &v1.Auth{ApiKeys: &v1.ApiKeysAuth{Roles: []string{"read"}}}
+	assert.NoError(t, validateEndpointAuth(k, nil, spec).ErrorList().ToAggregate())
+}
+
+func TestValidateClaims(t *testing.T) {
+	path := field.NewPath("spec", "auth")
+	claims := v1.Claims{
+		ScopesKey:     "scp",
+		ScopesMatcher: ScopesMatcherAll,
+		Roles:         []string{"admin"},
+		PropagateClaims: []v1.PropagateClaim{
+			{Claim: "oid", Header: "X-User"},
+			{Claim: "azp_name", Header: "X-Client"},
+		},
+	}
+	assert.Empty(t, validateClaims(path, claims))
+
+	claims.ScopesMatcher = "some"
+	claims.PropagateClaims = append(claims.PropagateClaims,
+		v1.PropagateClaim{Header: "X-Tenant"},
+		v1.PropagateClaim{Claim: "tid", Header: "X Tenant"},
+		v1.PropagateClaim{Claim: "sub", Header: "x-user"},
+		v1.PropagateClaim{Claim: "sub"},
+	)
+	fields := make([]string, 0)
+	for _, err := range validateClaims(path, claims) {
+		fields = append(fields, err.Field)
+	}
+	assert.Equal(t, []string{
+		"spec.auth.scopesMatcher",
+		"spec.auth.propagateClaims[2].claim",
+		"spec.auth.propagateClaims[3].header",
+		"spec.auth.propagateClaims[4].header",
+		"spec.auth.propagateClaims[5].header",
+	}, fields)
+}
+
+func TestValidateRequireClaims(t *testing.T) {
+	path := field.NewPath("spec", "auth", "requireClaims")
+	assert.Empty(t, validateRequireClaims(path, []string{`consumer.ID in ["0192:889640782"]`, "client_id == app1"}))
+
+	errs := validateRequireClaims(path, []string{"client_id == app1", "consumer.ID in 0192:889640782", "client_id"})
+	assert.Len(t, errs, 2)
+	assert.Equal(t, "spec.auth.requireClaims[1]", errs[0].Field)
+	assert.Equal(t, "spec.auth.requireClaims[2]", errs[1].Field)
+}
+
+func TestValidateApiEndpointsSpec(t *testing.T) {
+	spec := newApiEndpointSpec(paths("/users/{id}"))
+	spec.Endpoints[0].BackendPath = "/users/{id}/{JWT.sub}"
+	spec.Endpoints[0].TimeOut = "500ms"
+	spec.RateLimit = &v1.RateLimit{Strategy: "header", Key: "Authorization"}
+	assert.Empty(t, validateApiEndpointsSpec(spec))
+
+	spec.Endpoints[0].BackendHost = "host1.ns1"
+	spec.Endpoints[0].BackendPath = "/users/{userId}"
+	spec.Endpoints[0].TimeOut = "2"
+	spec.Endpoints[0].Method = "FETCH"
+	spec.RateLimit = &v1.RateLimit{Strategy: "header"}
+	spec.OpenEndpoints = []v1.Endpoint{
+		{
+			Path:      "/doc",
+			RateLimit: &v1.RateLimit{Strategy: "cookie"},
+			Backends: []v1.Backend{
+				{Hosts: []string{"http://app1", "app1-canary"}, Path: "/doc/{page}", Method: "get"},
+			},
+		},
+	}
+
+	fields := make([]string, 0)
+	for _, err := range validateApiEndpointsSpec(spec) {
+		fields = append(fields, err.Field)
+	}
+	assert.Equal(t, []string{
+		"spec.rateLimit.key",
+		"spec.endpoints[0].method",
+		"spec.endpoints[0].timeout",
+		"spec.endpoints[0].backendHost",
+		"spec.endpoints[0].backendPath",
+		"spec.openEndpoints[0].rateLimit.strategy",
+		"spec.openEndpoints[0].backends[0].hosts[1]",
+		"spec.openEndpoints[0].backends[0].path",
+	}, fields)
+
+	spec.RateLimit.Disabled = true
+	assert.Len(t, validateApiEndpointsSpec(spec), 7)
+
+	spec.OpenEndpoints[0].Backends[0].Hosts = []string{}
+	errs := validateApiEndpointsSpec(spec)
+	assert.Len(t, errs, 7)
+	assert.Contains(t, errs, field.Required(field.NewPath("spec", "openEndpoints").Index(0).Child("backends").Index(0).Child("hosts"), "at least one host is required"))
+}
+
+func TestValidateBackendRateLimitAndCircuitBreaker(t *testing.T) {
+	spec := newApiEndpointSpec(paths("/users"))
+	spec.BackendRateLimit = &v1.BackendRateLimit{MaxRate: 100, Capacity: 10, Every: "1m"}
+	spec.CircuitBreaker = &v1.CircuitBreaker{Interval: 60, Timeout: 10, MaxErrors: 5}
+	assert.Empty(t, validateApiEndpointsSpec(spec))
+
+	spec.BackendRateLimit = &v1.BackendRateLimit{Capacity: -1, Every: "0s"}
+	spec.CircuitBreaker = &v1.CircuitBreaker{MaxErrors: 5}
+	spec.Endpoints[0].BackendRateLimit = &v1.BackendRateLimit{MaxRate: 10, Every: "often"}
+	spec.Endpoints[0].CircuitBreaker = &v1.CircuitBreaker{Interval: 60, Timeout: -10, MaxErrors: 0}
+
+	fields := make([]string, 0)
+	for _, err := range validateApiEndpointsSpec(spec) {
+		fields = append(fields, err.Field)
+	}
+	assert.Equal(t, []string{
+		"spec.backendRateLimit.maxRate",
+		"spec.backendRateLimit.capacity",
+		"spec.backendRateLimit.every",
+		"spec.circuitBreaker.interval",
+		"spec.circuitBreaker.timeout",
+		"spec.endpoints[0].backendRateLimit.every",
+		"spec.endpoints[0].circuitBreaker.timeout",
+		"spec.endpoints[0].circuitBreaker.maxErrors",
+	}, fields)
+
+	// disabled rate limits and circuit breakers are not validated
+	spec.BackendRateLimit.Disabled = true
+	spec.CircuitBreaker.Disabled = true
+	spec.Endpoints[0].BackendRateLimit.Disabled = true
+	spec.Endpoints[0].CircuitBreaker.Disabled = true
+	assert.Empty(t, validateApiEndpointsSpec(spec))
+}
+
 func parseYaml(file string, v any) error {
 	reader, err := os.Open(file)
 	if err != nil {
@@ -200,7 +406,7 @@ func paths(paths ...string) option {
 	}
 }
 
-func krakend(krakend string) option {
+func krakendName(krakend string) option {
 	return func(o *options) {
 		o.Krakend = krakend
 	}
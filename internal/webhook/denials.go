@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"github.com/nais/krakend/internal/metrics"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	ReasonPathConflict      = "PathConflict"
+	ReasonAuthProviderInUse = "AuthProviderInUse"
+)
+
+// Denial is a validation error with the reason it is denied for, named as the reasons of the status conditions
+type Denial struct {
+	*field.Error
+	Reason string
+}
+
+// Denials are the validation errors of a request
+type Denials []Denial
+
+// deny returns the errors as denials for the reason
+func deny(reason string, errs ...*field.Error) Denials {
+	denials := make(Denials, 0, len(errs))
+	for _, err := range errs {
+		denials = append(denials, Denial{Error: err, Reason: reason})
+	}
+	return denials
+}
+
+// ErrorList returns the validation errors of the denials
+func (d Denials) ErrorList() field.ErrorList {
+	errs := make(field.ErrorList, 0, len(d))
+	for _, denial := range d {
+		errs = append(errs, denial.Error)
+	}
+	return errs
+}
+
+// Reasons returns the distinct reasons of the denials
+func (d Denials) Reasons() []string {
+	reasons := sets.New[string]()
+	for _, denial := range d {
+		reasons.Insert(denial.Reason)
+	}
+	return sets.List(reasons)
+}
+
+// recordDenial counts a denied request once for each distinct reason of the denials
+func recordDenial(webhook string, denials Denials) {
+	for _, reason := range denials.Reasons() {
+		metrics.WebhookDenials.WithLabelValues(webhook, reason).Inc()
+	}
+}
@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"testing"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestDenialReasons(t *testing.T) {
+	k := &krakendv1.Krakend{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: krakendv1.KrakendSpec{
+			AuthProviders: []krakendv1.AuthProvider{{Name: "maskinporten"}},
+		},
+	}
+	existing := apiEndpoints("app1", "default", newApiEndpointSpec(paths("/a")))
+
+	spec := newApiEndpointSpec(paths("/a", "/b"))
+	spec.Endpoints[1].TimeOut = "forever"
+	spec.Endpoints[1].Auth = &krakendv1.Auth{Name: "tokenx"}
+	a := apiEndpoints("app2", "default", spec)
+
+	denials := ValidateApiEndpoints(k, nil, a, &krakendv1.ApiEndpointsList{Items: []krakendv1.ApiEndpoints{*existing}})
+	assert.Len(t, denials, 3)
+	assert.Equal(t, []string{
+		krakendv1.ReasonAuthProviderNotFound,
+		krakendv1.ReasonInvalidSpec,
+		ReasonPathConflict,
+	}, denials.Reasons())
+	assert.Len(t, denials.ErrorList(), 3)
+}
+
+func TestRecordDenial(t *testing.T) {
+	counter := metrics.WebhookDenials.WithLabelValues("test", krakendv1.ReasonInvalidSpec)
+	before := testutil.ToFloat64(counter)
+
+	// a request is counted once per reason, regardless of the number of errors
+	recordDenial("test", deny(krakendv1.ReasonInvalidSpec,
+		field.Required(field.NewPath("spec", "ingressHost"), MsgIngressHostMissing),
+		field.Required(field.NewPath("spec", "authProviders").Index(0).Child("name"), ""),
+	))
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+}
@@ -0,0 +1,291 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/krakend"
+	log "github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	MsgIngressHostMissing = "either ingressHost or ingress.hosts must be specified"
+	MsgAuthProviderInUse  = "auth provider is referenced by ApiEndpoints"
+	MsgApiKeysInUse       = "apiKeys are used by ApiEndpoints"
+	MsgApiKeysEnterprise  = "apiKeys require a KrakenD Enterprise image, e.g. krakend/krakend-ee in spec.deployment.image.repository"
+	// MaxPartialsShards is the maximum number of shards of the partials ConfigMap
+	MaxPartialsShards = 16
+
+	ApiKeysStrategyHeader      = "header"
+	ApiKeysStrategyQueryString = "query_string"
+	// EnterpriseImageRepository is the name of the repository of the KrakenD Enterprise images, KrakenD Community
+	// Edition ignores the Enterprise features in the config, e.g. it serves endpoints with API keys without checking them
+	EnterpriseImageRepository = "krakend-ee"
+)
+
+var (
+	// SupportedAlgs are the signing algorithms supported by the KrakenD JWT validator
+	SupportedAlgs = []string{
+		"EdDSA",
+		"HS256", "HS384", "HS512",
+		"RS256", "RS384", "RS512",
+		"ES256", "ES384", "ES512",
+		"PS256", "PS384", "PS512",
+	}
+	// SupportedDeploymentTypes are the deployment types supported by the KrakenD chart
+	SupportedDeploymentTypes = []string{"deployment", "rollout"}
+
+	// apiKeyRolePattern is the allowed roles of API keys, which are rendered into the flexible config of KrakenD
+	apiKeyRolePattern = regexp.MustCompile(`^[\w.:-]+$`)
+)
+
+//+kubebuilder:webhook:path=/validate-krakends,mutating=false,failurePolicy=fail,sideEffects=None,groups=krakend.nais.io,resources=krakends,verbs=create;update,versions=v1,name=krakends.krakend.nais.io,admissionReviewVersions=v1
+
+type KrakendValidator struct {
+	// AuthProviders is the catalogue of auth providers available to the ApiEndpoints of all Krakends
+	AuthProviders krakend.AuthProviderCatalogue
+	client        client.Client
+	decoder       *admission.Decoder
+}
+
+func (v *KrakendValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	log.Infof("registering webhook server at /validate-krakends")
+	v.decoder = admission.NewDecoder(mgr.GetScheme())
+	v.client = mgr.GetClient()
+	mgr.GetWebhookServer().Register("/validate-krakends", &webhook.Admission{Handler: v})
+	return nil
+}
+
+func (v *KrakendValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	k := &krakendv1.Krakend{}
+	err := v.decoder.Decode(req, k)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if k.GetDeletionTimestamp() != nil {
+		return admission.Allowed("")
+	}
+
+	denials := deny(krakendv1.ReasonInvalidSpec, ValidateKrakend(k)...)
+
+	if req.Operation == admissionv1.Update {
+		old := &krakendv1.Krakend{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		removed := removedAuthProviders(v.AuthProviders, old, k)
+		apiKeysRemoved := old.Spec.ApiKeys != nil && k.Spec.ApiKeys == nil
+		if len(removed) > 0 || apiKeysRemoved {
+			el := &krakendv1.ApiEndpointsList{}
+			if err := v.client.List(ctx, el, client.InNamespace(k.Namespace)); err != nil {
+				return admission.Errored(http.StatusInternalServerError, fmt.Errorf("getting list of apiendpoints: %w", err))
+			}
+			denials = append(denials, deny(ReasonAuthProviderInUse, validateRemovedAuthProviders(k, removed, el.Items)...)...)
+			if apiKeysRemoved {
+				denials = append(denials, deny(ReasonAuthProviderInUse, validateRemovedApiKeys(k, el.Items)...)...)
+			}
+		}
+	}
+
+	if len(denials) > 0 {
+		recordDenial("krakends", denials)
+		return admission.Denied(denials.ErrorList().ToAggregate().Error())
+	}
+	return admission.Allowed("")
+}
+
+// ValidateKrakend validates the parts of the Krakend spec that would otherwise fail when rendering the chart or the endpoints
+func ValidateKrakend(k *krakendv1.Krakend) field.ErrorList {
+	errs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	ingressPath := specPath.Child("ingress")
+	if len(k.Spec.Ingress.Hosts) == 0 && k.Spec.IngressHost == "" {
+		errs = append(errs, field.Required(specPath.Child("ingressHost"), MsgIngressHostMissing))
+	}
+	for i, h := range k.Spec.Ingress.Hosts {
+		if h.Host == "" {
+			errs = append(errs, field.Required(ingressPath.Child("hosts").Index(i).Child("host"), ""))
+		}
+	}
+
+	deploymentType := k.Spec.Deployment.DeploymentType
+	if deploymentType != "" && !sets.New(SupportedDeploymentTypes...).Has(deploymentType) {
+		errs = append(errs, field.NotSupported(specPath.Child("deployment", "deploymentType"), deploymentType, SupportedDeploymentTypes))
+	}
+	if shards := k.Spec.Partials.Shards; shards < 0 || shards > MaxPartialsShards {
+		errs = append(errs, field.Invalid(specPath.Child("partials", "shards"), shards, fmt.Sprintf("must be between 0 and %d", MaxPartialsShards)))
+	}
+
+	names := sets.New[string]()
+	for i, p := range k.Spec.AuthProviders {
+		path := specPath.Child("authProviders").Index(i)
+		if p.Name == "" {
+			errs = append(errs, field.Required(path.Child("name"), ""))
+		} else if names.Has(p.Name) {
+			errs = append(errs, field.Duplicate(path.Child("name"), p.Name))
+		}
+		names.Insert(p.Name)
+
+		// auth providers without alg use the default RS256
+		if p.Alg != "" && !sets.New(SupportedAlgs...).Has(p.Alg) {
+			errs = append(errs, field.NotSupported(path.Child("alg"), p.Alg, SupportedAlgs))
+		}
+		if err := validateUrl(p.JwkUrl); err != nil {
+			errs = append(errs, field.Invalid(path.Child("jwkUrl"), p.JwkUrl, err.Error()))
+		}
+		if err := validateUrl(p.Issuer); err != nil {
+			errs = append(errs, field.Invalid(path.Child("issuer"), p.Issuer, err.Error()))
+		}
+		errs = append(errs, validateClaims(path, p.Claims)...)
+	}
+	if k.Spec.ApiKeys != nil {
+		if !isEnterpriseImage(k.Spec.Deployment.Image) {
+			errs = append(errs, field.Forbidden(specPath.Child("apiKeys"), MsgApiKeysEnterprise))
+		}
+		errs = append(errs, validateApiKeys(specPath.Child("apiKeys"), k.Spec.ApiKeys)...)
+	}
+	return errs
+}
+
+// isEnterpriseImage returns whether the image is KrakenD Enterprise, by the name of its repository, which mirrors keep.
+// Without a repository the Community Edition image of the chart is used.
+func isEnterpriseImage(image krakendv1.Image) bool {
+	return path.Base(image.Repository) == EnterpriseImageRepository
+}
+
+// validateApiKeys validates the API keys, their names are used for the files of the keys mounted into KrakenD and their
+// roles are rendered into the config
+func validateApiKeys(path *field.Path, a *krakendv1.ApiKeys) field.ErrorList {
+	errs := field.ErrorList{}
+	switch a.Strategy {
+	case "", ApiKeysStrategyHeader, ApiKeysStrategyQueryString:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("strategy"), a.Strategy, []string{ApiKeysStrategyHeader, ApiKeysStrategyQueryString}))
+	}
+	if a.Strategy != ApiKeysStrategyQueryString && a.Identifier != "" {
+		for _, msg := range validation.IsHTTPHeaderName(a.Identifier) {
+			errs = append(errs, field.Invalid(path.Child("identifier"), a.Identifier, msg))
+		}
+	}
+	if len(a.Keys) == 0 {
+		errs = append(errs, field.Required(path.Child("keys"), ""))
+	}
+
+	names := sets.New[string]()
+	for i, key := range a.Keys {
+		keyPath := path.Child("keys").Index(i)
+		for _, msg := range validation.IsDNS1123Label(key.Name) {
+			errs = append(errs, field.Invalid(keyPath.Child("name"), key.Name, msg))
+		}
+		if names.Has(key.Name) {
+			errs = append(errs, field.Duplicate(keyPath.Child("name"), key.Name))
+		}
+		names.Insert(key.Name)
+
+		if key.SecretKeyRef.Name == "" {
+			errs = append(errs, field.Required(keyPath.Child("secretKeyRef", "name"), ""))
+		}
+		if key.SecretKeyRef.Key == "" {
+			errs = append(errs, field.Required(keyPath.Child("secretKeyRef", "key"), ""))
+		}
+		for j, role := range key.Roles {
+			if !apiKeyRolePattern.MatchString(role) {
+				errs = append(errs, field.Invalid(keyPath.Child("roles").Index(j), role, "must consist of alphanumeric characters, '-', '_', '.' or ':'"))
+			}
+		}
+	}
+	return errs
+}
+
+// validateRemovedAuthProviders rejects removal of auth providers still referenced by ApiEndpoints targeting the Krakend
+func validateRemovedAuthProviders(k *krakendv1.Krakend, removed sets.Set[string], list []krakendv1.ApiEndpoints) field.ErrorList {
+	errs := field.ErrorList{}
+	path := field.NewPath("spec", "authProviders")
+	for _, a := range list {
+		if a.GetDeletionTimestamp() != nil || a.KrakendName() != k.Name {
+			continue
+		}
+		for _, name := range sets.List(referencedAuthProviders(a.Spec).Intersection(removed)) {
+			errs = append(errs, field.Forbidden(path, fmt.Sprintf("%s: '%s' is used by %s", MsgAuthProviderInUse, name, a.Name)))
+		}
+	}
+	return errs
+}
+
+// validateRemovedApiKeys rejects removal of the API keys while ApiEndpoints targeting the Krakend authenticate with them
+func validateRemovedApiKeys(k *krakendv1.Krakend, list []krakendv1.ApiEndpoints) field.ErrorList {
+	errs := field.ErrorList{}
+	for _, a := range list {
+		if a.GetDeletionTimestamp() != nil || a.KrakendName() != k.Name || !usesApiKeys(a.Spec) {
+			continue
+		}
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "apiKeys"), fmt.Sprintf("%s: %s", MsgApiKeysInUse, a.Name)))
+	}
+	return errs
+}
+
+// usesApiKeys returns true if the ApiEndpoints, or any of its endpoints, authenticates with the API keys of the Krakend
+func usesApiKeys(spec krakendv1.ApiEndpointsSpec) bool {
+	if spec.Auth.ApiKeys != nil {
+		return true
+	}
+	for _, e := range spec.Endpoints {
+		if e.Auth != nil && e.Auth.ApiKeys != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// removedAuthProviders returns the names of the auth providers available to old that are not available to k, auth
+// providers removed from the Krakend are still available if they are in the catalogue
+func removedAuthProviders(catalogue krakend.AuthProviderCatalogue, old, k *krakendv1.Krakend) sets.Set[string] {
+	return authProviderNames(catalogue, old).Difference(authProviderNames(catalogue, k))
+}
+
+func authProviderNames(catalogue krakend.AuthProviderCatalogue, k *krakendv1.Krakend) sets.Set[string] {
+	names := sets.New[string]()
+	for _, p := range catalogue.AuthProviders(k) {
+		names.Insert(p.Name)
+	}
+	return names
+}
+
+// referencedAuthProviders returns the names of the auth providers used by the ApiEndpoints, including endpoint overrides
+func referencedAuthProviders(spec krakendv1.ApiEndpointsSpec) sets.Set[string] {
+	names := sets.New[string]()
+	if spec.Auth.Name != "" {
+		names.Insert(spec.Auth.Name)
+	}
+	for _, e := range spec.Endpoints {
+		if e.Auth != nil && e.Auth.Name != "" {
+			names.Insert(e.Auth.Name)
+		}
+	}
+	return names
+}
+
+func validateUrl(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("must be a valid URL: %w", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("must be an absolute http or https URL")
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/krakend"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ = Describe("Krakend Validating Webhook", func() {
+	var k *v1.Krakend
+
+	BeforeEach(func() {
+		k = validKrakend("krakend-webhook", "default")
+	})
+
+	Context("Create Krakend", func() {
+		It("should create a valid Krakend successfully", func() {
+			Expect(k8sClient.Create(ctx, k)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, k)).Should(Succeed())
+		})
+
+		It("should fail to create a Krakend without ingress hosts", func() {
+			k.Spec.IngressHost = ""
+			Expect(k8sClient.Create(ctx, k)).Should(MatchError(ContainSubstring(MsgIngressHostMissing)))
+		})
+
+		It("should fail to create a Krakend with an unsupported alg", func() {
+			k.Spec.AuthProviders[0].Alg = "none"
+			Expect(k8sClient.Create(ctx, k)).Should(MatchError(ContainSubstring("spec.authProviders[0].alg")))
+		})
+	})
+
+	Context("Update Krakend", func() {
+		It("should fail to remove an auth provider referenced by ApiEndpoints", func() {
+			Expect(k8sClient.Create(ctx, k)).Should(Succeed())
+
+			spec := newApiEndpointSpec(krakendName(k.Name), paths("/krakend_webhook_in_use"))
+			a := apiEndpoints("uses-maskinporten", "default", spec)
+			Expect(k8sClient.Create(ctx, a)).Should(Succeed())
+
+			fetched := &v1.Krakend{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: k.Name, Namespace: k.Namespace}, fetched)).Should(Succeed())
+			fetched.Spec.AuthProviders = nil
+			Expect(k8sClient.Update(ctx, fetched)).Should(MatchError(ContainSubstring(MsgAuthProviderInUse)))
+
+			Expect(k8sClient.Delete(ctx, a)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, k)).Should(Succeed())
+		})
+	})
+})
+
+func TestValidateKrakendSpec(t *testing.T) {
+	k := validKrakend("default", "default")
+	assert.Empty(t, ValidateKrakend(k))
+
+	// Krakends created before the webhook have auth providers without alg
+	k.Spec.AuthProviders[0].Alg = ""
+	assert.Empty(t, ValidateKrakend(k))
+
+	k.Spec.IngressHost = ""
+	k.Spec.Ingress.Hosts = []v1.Host{{Host: "krakend.example.com"}, {}}
+	errs := ValidateKrakend(k)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.ingress.hosts[1].host", errs[0].Field)
+
+	k.Spec.Ingress.Hosts = nil
+	errs = ValidateKrakend(k)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, field.ErrorTypeRequired, errs[0].Type)
+
+	k = validKrakend("default", "default")
+	k.Spec.Deployment.DeploymentType = "statefulset"
+	k.Spec.Partials.Shards = MaxPartialsShards + 1
+	k.Spec.AuthProviders = append(k.Spec.AuthProviders,
+		v1.AuthProvider{Name: "maskinporten", Alg: "RS256", JwkUrl: "https://test.maskinporten.no/jwk", Issuer: "https://test.maskinporten.no/"},
+		v1.AuthProvider{Alg: "none", JwkUrl: "/jwk", Issuer: "maskinporten"},
+		v1.AuthProvider{Name: "azuread", Alg: "RS256", JwkUrl: "https://login.microsoftonline.com/tenant/discovery/v2.0/keys", Issuer: "https://login.microsoftonline.com/tenant/v2.0",
+			Claims: v1.Claims{ScopesKey: "scp", ScopesMatcher: "some"}},
+	)
+	fields := make([]string, 0)
+	for _, err := range ValidateKrakend(k) {
+		fields = append(fields, err.Field)
+	}
+	assert.Equal(t, []string{
+		"spec.deployment.deploymentType",
+		"spec.partials.shards",
+		"spec.authProviders[1].name",
+		"spec.authProviders[2].name",
+		"spec.authProviders[2].alg",
+		"spec.authProviders[2].jwkUrl",
+		"spec.authProviders[2].issuer",
+		"spec.authProviders[3].scopesMatcher",
+	}, fields)
+}
+
+func TestValidateApiKeys(t *testing.T) {
+	k := validKrakend("default", "default")
+	k.Spec.ApiKeys = &v1.ApiKeys{
+		Keys: []v1.ApiKey{apiKey("partner1", "read", "write:all")},
+	}
+	// API keys are a feature of KrakenD Enterprise, the default image is the Community Edition
+	errs := ValidateKrakend(k)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.apiKeys", errs[0].Field)
+	assert.Contains(t, errs[0].Detail, MsgApiKeysEnterprise)
+	k.Spec.Deployment.Image.Repository = "devopsfaith/krakend"
+	assert.Len(t, ValidateKrakend(k), 1)
+
+	k.Spec.Deployment.Image.Repository = "krakend/krakend-ee"
+	assert.Empty(t, ValidateKrakend(k))
+	k.Spec.Deployment.Image = v1.Image{Registry: "europe-north1-docker.pkg.dev", Repository: "nais-io/mirror/krakend-ee"}
+	assert.Empty(t, ValidateKrakend(k))
+
+	k.Spec.ApiKeys = &v1.ApiKeys{
+		Strategy:   "cookie",
+		Identifier: "X Api Key",
+		Keys: []v1.ApiKey{
+			apiKey("partner1"),
+			apiKey("partner1"),
+			apiKey("Partner_2", `{{ env "KEY" }}`),
+			{Name: "partner3"},
+		},
+	}
+	fields := make([]string, 0)
+	for _, err := range ValidateKrakend(k) {
+		fields = append(fields, err.Field)
+	}
+	assert.Equal(t, []string{
+		"spec.apiKeys.strategy",
+		"spec.apiKeys.identifier",
+		"spec.apiKeys.keys[1].name",
+		"spec.apiKeys.keys[2].name",
+		"spec.apiKeys.keys[2].roles[0]",
+		"spec.apiKeys.keys[3].secretKeyRef.name",
+		"spec.apiKeys.keys[3].secretKeyRef.key",
+	}, fields)
+
+	k.Spec.ApiKeys = &v1.ApiKeys{Strategy: "query_string", Identifier: "api key"}
+	errs = ValidateKrakend(k)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.apiKeys.keys", errs[0].Field)
+}
+
+func TestValidateRemovedApiKeys(t *testing.T) {
+	k := validKrakend("default", "default")
+
+	common := newApiEndpointSpec()
+	common.Auth = v1.Auth{ApiKeys: &v1.ApiKeysAuth{Roles: []string{"read"}}}
+	override := newApiEndpointSpec(paths("/partner"))
+	override.Endpoints[0].Auth = &v1.Auth{ApiKeys: &v1.ApiKeysAuth{Roles: []string{"read"}}}
+	unused := newApiEndpointSpec(paths("/unused"))
+
+	list := []v1.ApiEndpoints{
+		*apiEndpoints("common", "default", common),
+		*apiEndpoints("override", "default", override),
+		*apiEndpoints("unused", "default", unused),
+	}
+	errs := validateRemovedApiKeys(k, list)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, errs[0].Detail, MsgApiKeysInUse+": common")
+	assert.Contains(t, errs[1].Detail, MsgApiKeysInUse+": override")
+}
+
+func TestValidateRemovedAuthProviders(t *testing.T) {
+	old := validKrakend("default", "default")
+	old.Spec.AuthProviders = append(old.Spec.AuthProviders, v1.AuthProvider{Name: "azuread"})
+	k := validKrakend("default", "default")
+
+	removed := removedAuthProviders(nil, old, k)
+	assert.Equal(t, sets.New("azuread"), removed)
+
+	common := newApiEndpointSpec(auth("azuread"))
+	override := newApiEndpointSpec(paths("/admin"))
+	override.Endpoints[0].Auth = &v1.Auth{Name: "azuread"}
+	other := newApiEndpointSpec(auth("azuread"), krakendName("other"))
+	unused := newApiEndpointSpec(paths("/unused"))
+
+	list := []v1.ApiEndpoints{
+		*apiEndpoints("common", "default", common),
+		*apiEndpoints("override", "default", override),
+		*apiEndpoints("other", "default", other),
+		*apiEndpoints("unused", "default", unused),
+	}
+	errs := validateRemovedAuthProviders(k, removed, list)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, errs[0].Detail, "common")
+	assert.Contains(t, errs[1].Detail, "override")
+
+	// auth providers in the catalogue are still available when removed from the Krakend
+	catalogue := krakend.AuthProviderCatalogue{{Name: "azuread"}}
+	assert.Empty(t, removedAuthProviders(catalogue, old, k))
+	assert.NoError(t, validateAuth(k, catalogue, v1.Auth{Name: "azuread"}))
+}
+
+func apiKey(name string, roles ...string) v1.ApiKey {
+	return v1.ApiKey{
+		Name: name,
+		SecretKeyRef: corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name + "-apikey"},
+			Key:                  "key",
+		},
+		Roles: roles,
+	}
+}
+
+func validKrakend(name, namespace string) *v1.Krakend {
+	return &v1.Krakend{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: v1.KrakendSpec{
+			IngressHost: "krakend.example.com",
+			AuthProviders: []v1.AuthProvider{
+				{
+					Name:   "maskinporten",
+					Alg:    "RS256",
+					JwkUrl: "https://test.maskinporten.no/jwk",
+					Issuer: "https://test.maskinporten.no/",
+				},
+			},
+		},
+	}
+}
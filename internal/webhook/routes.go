@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+)
+
+// route is an endpoint as registered in the KrakenD router, which keeps a separate tree of paths per method
+type route struct {
+	method   string
+	path     string
+	segments []string
+	owner    string
+}
+
+func newRoute(e krakendv1.Endpoint, owner string) route {
+	e.Default()
+	return route{
+		method:   e.Method,
+		path:     e.Path,
+		segments: strings.Split(strings.TrimPrefix(e.Path, "/"), "/"),
+		owner:    owner,
+	}
+}
+
+// template returns the path with the names of parameters and wildcards removed, e.g. /users/{} for /users/{id}
+func (r route) template() string {
+	segments := make([]string, len(r.segments))
+	for i, s := range r.segments {
+		switch {
+		case isParam(s):
+			segments[i] = "{}"
+		case isWildcard(s):
+			segments[i] = "*"
+		default:
+			segments[i] = s
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// conflicts returns an error if both routes cannot be registered in the router, i.e. if they have the same method and
+//   - the same path template, e.g. /users/{id} and /users/{name}
+//   - parameters with different names in the same position after a common prefix, e.g. /users/{id} and /users/{name}/posts
+//   - a wildcard in the same position as any other segment after a common prefix, e.g. /files/* and /files/{id}
+func (r route) conflicts(other route) error {
+	if r.method != other.method {
+		return nil
+	}
+	if r.template() == other.template() {
+		return fmt.Errorf("%s %s in %s and %s %s in %s have the same path", r.method, r.path, r.owner, other.method, other.path, other.owner)
+	}
+
+	for i := 0; i < len(r.segments) && i < len(other.segments); i++ {
+		s, o := r.segments[i], other.segments[i]
+		switch {
+		case isWildcard(s) || isWildcard(o):
+			return fmt.Errorf("%s %s in %s conflicts with %s %s in %s: wildcard conflicts with segment in the same position", r.method, r.path, r.owner, other.method, other.path, other.owner)
+		case isParam(s) && isParam(o):
+			if s != o {
+				return fmt.Errorf("%s %s in %s conflicts with %s %s in %s: parameters %s and %s in the same position", r.method, r.path, r.owner, other.method, other.path, other.owner, s, o)
+			}
+		case s != o:
+			// the paths diverge, static segments are matched before parameters
+			return nil
+		}
+	}
+	return nil
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func isWildcard(segment string) bool {
+	return strings.HasPrefix(segment, "*")
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/nais/krakend/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteConflicts(t *testing.T) {
+	tt := []struct {
+		name     string
+		a, b     v1.Endpoint
+		conflict bool
+	}{
+		{
+			name: "same path with different methods",
+			a:    v1.Endpoint{Path: "/users", Method: "GET"},
+			b:    v1.Endpoint{Path: "/users", Method: "POST"},
+		},
+		{
+			name:     "same path with default method",
+			a:        v1.Endpoint{Path: "/users"},
+			b:        v1.Endpoint{Path: "/users/", Method: "get"},
+			conflict: true,
+		},
+		{
+			name:     "parameters with different names",
+			a:        v1.Endpoint{Path: "/users/{id}"},
+			b:        v1.Endpoint{Path: "/users/{name}"},
+			conflict: true,
+		},
+		{
+			name:     "parameters with different names in longer path",
+			a:        v1.Endpoint{Path: "/users/{id}"},
+			b:        v1.Endpoint{Path: "/users/{name}/posts"},
+			conflict: true,
+		},
+		{
+			name: "parameters with the same name in longer path",
+			a:    v1.Endpoint{Path: "/users/{id}"},
+			b:    v1.Endpoint{Path: "/users/{id}/posts"},
+		},
+		{
+			name: "static segment and parameter",
+			a:    v1.Endpoint{Path: "/users/new"},
+			b:    v1.Endpoint{Path: "/users/{id}"},
+		},
+		{
+			name: "parameters after different static segments",
+			a:    v1.Endpoint{Path: "/users/{id}"},
+			b:    v1.Endpoint{Path: "/teams/{name}"},
+		},
+		{
+			name:     "wildcard and parameter",
+			a:        v1.Endpoint{Path: "/files/*"},
+			b:        v1.Endpoint{Path: "/files/{id}"},
+			conflict: true,
+		},
+		{
+			name:     "wildcard and static segment",
+			a:        v1.Endpoint{Path: "/files/*path"},
+			b:        v1.Endpoint{Path: "/files/readme"},
+			conflict: true,
+		},
+		{
+			name: "wildcard after different static segments",
+			a:    v1.Endpoint{Path: "/files/*"},
+			b:    v1.Endpoint{Path: "/docs/readme"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := newRoute(tc.a, "a"), newRoute(tc.b, "b")
+			if tc.conflict {
+				assert.Error(t, a.conflicts(b))
+				assert.Error(t, b.conflicts(a))
+			} else {
+				assert.NoError(t, a.conflicts(b))
+				assert.NoError(t, b.conflicts(a))
+			}
+		})
+	}
+}
+
+func TestUniquePathsPerKrakend(t *testing.T) {
+	existing := apiEndpoints("existing", "default", newApiEndpointSpec(paths("/users/{id}")))
+	other := apiEndpoints("other", "default", newApiEndpointSpec(krakendName("other"), paths("/users/{name}")))
+	list := &v1.ApiEndpointsList{Items: []v1.ApiEndpoints{*existing}}
+
+	assert.NoError(t, validateEndpointsList(list, other))
+
+	conflicting := apiEndpoints("conflicting", "default", newApiEndpointSpec(paths("/users/{name}")))
+	list = &v1.ApiEndpointsList{Items: []v1.ApiEndpoints{*existing, *other}}
+	assert.ErrorContains(t, validateEndpointsList(list, conflicting), MsgPathDuplicate)
+	// the list of the caller is left as is
+	assert.Equal(t, []v1.ApiEndpoints{*existing, *other}, list.Items)
+}
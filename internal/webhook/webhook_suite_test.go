@@ -114,7 +114,9 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).NotTo(HaveOccurred())
 
+	mgr.GetWebhookServer().Register("/mutate-apiendpoints", &webhook.Admission{Handler: &ApiEndpointsDefaulter{decoder: admission.NewDecoder(scheme)}})
 	mgr.GetWebhookServer().Register("/validate-apiendpoints", &webhook.Admission{Handler: &ApiEndpointsValidator{client: mgr.GetClient(), decoder: admission.NewDecoder(testEnv.Scheme)}})
+	mgr.GetWebhookServer().Register("/validate-krakends", &webhook.Admission{Handler: &KrakendValidator{client: mgr.GetClient(), decoder: admission.NewDecoder(scheme)}})
 
 	//+kubebuilder:scaffold:webhook
 
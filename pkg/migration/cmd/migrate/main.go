@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nais/krakend/internal/krakend"
+	"github.com/nais/krakend/pkg/migration"
+	"github.com/nais/krakend/pkg/migration/kubernetes"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const usage = `migrate converts Krakends and their ApiEndpoints to NAIS Applications running KrakenD
+
+Usage:
+  migrate [flags]                          convert the resources in the cluster of the current kubeconfig context
+  migrate [flags] <file or directory>...   convert the resources in the files, e.g. exported with kubectl get -o yaml
+
+ApiEndpoints are migrated with the Krakend they target, as resolved by the operator, and the ones not targeting any of
+the Krakends are reported. With -diff, the endpoints are compared with the partials ConfigMaps deployed by the operator
+in the cluster, and nothing is written.
+
+Flags:
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	namespace := flag.String("namespace", "", "Namespace to migrate, defaults to the namespace of the kubeconfig context. For files, the namespace of resources without one")
+	allNamespaces := flag.Bool("all-namespaces", false, "Migrate the resources in all namespaces of the cluster")
+	output := flag.String("o", "", "Directory to write a file per Krakend to, named <namespace>-<name>.yaml, instead of stdout")
+	diff := flag.Bool("diff", false, "Compare the endpoints with the partials ConfigMaps deployed in the cluster instead of writing the resources")
+	authProviders := flag.String("auth-providers", "", "Path to the catalogue of auth providers available to all Krakends, as configured for the operator")
+	flag.Parse()
+
+	log.SetOutput(os.Stderr)
+
+	// the migrated Applications do not use the catalogue, the auth providers are rendered into their config
+	var catalogue krakend.AuthProviderCatalogue
+	if *authProviders != "" {
+		var err error
+		catalogue, err = krakend.LoadAuthProviderCatalogue(*authProviders)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	opts := options{
+		namespace:     *namespace,
+		allNamespaces: *allNamespaces,
+		output:        *output,
+		diff:          *diff,
+		files:         flag.Args(),
+		authProviders: catalogue,
+	}
+	if err := run(context.Background(), opts); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	namespace     string
+	allNamespaces bool
+	output        string
+	diff          bool
+	files         []string
+	// authProviders is the catalogue of auth providers of the operator
+	authProviders krakend.AuthProviderCatalogue
+}
+
+func run(ctx context.Context, opts options) error {
+	if opts.diff && opts.output != "" {
+		return fmt.Errorf("-diff and -o are mutually exclusive")
+	}
+
+	var in *migration.Input
+	var c client.Client
+	var err error
+	if len(opts.files) > 0 {
+		if opts.allNamespaces {
+			return fmt.Errorf("-all-namespaces only applies to the cluster, the files are migrated as they are")
+		}
+		namespace := opts.namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		in, err = migration.FromFiles(opts.files, namespace)
+		if err == nil && opts.diff {
+			c, _, err = kubernetes.NewClient()
+		}
+	} else {
+		c, in, err = fromCluster(ctx, opts.namespace, opts.allNamespaces)
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := migration.Convert(in, opts.authProviders)
+	if err != nil {
+		return err
+	}
+	for _, s := range result.Skipped {
+		log.Warnf("skipping ApiEndpoints %s", s)
+	}
+	if len(result.Outputs) == 0 {
+		return fmt.Errorf("no Krakends found")
+	}
+
+	switch {
+	case opts.diff:
+		return diff(ctx, c, result.Outputs)
+	case opts.output == "":
+		for i, o := range result.Outputs {
+			if i > 0 {
+				fmt.Println("---")
+			}
+			fmt.Print(o.YAML)
+		}
+		return nil
+	default:
+		return write(opts.output, result.Outputs)
+	}
+}
+
+func diff(ctx context.Context, c client.Client, outputs []migration.Output) error {
+	for _, o := range outputs {
+		d, err := migration.Diff(ctx, c, o)
+		if err != nil {
+			return err
+		}
+		if d == "" {
+			fmt.Printf("%s/%s: no differences\n", o.Namespace, o.Name)
+			continue
+		}
+		fmt.Printf("%s/%s: %s\n%s", o.Namespace, o.Name, migration.DeployedPartialsName(o.Name), d)
+	}
+	return nil
+}
+
+func write(dir string, outputs []migration.Output) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, o := range outputs {
+		path := filepath.Join(dir, o.FileName())
+		if err := os.WriteFile(path, []byte(o.YAML), 0o644); err != nil {
+			return err
+		}
+		log.Infof("wrote %s/%s to %s", o.Namespace, o.Name, path)
+	}
+	return nil
+}
+
+func fromCluster(ctx context.Context, namespace string, allNamespaces bool) (client.Client, *migration.Input, error) {
+	if allNamespaces && namespace != "" {
+		return nil, nil, fmt.Errorf("-namespace and -all-namespaces are mutually exclusive")
+	}
+	c, current, err := kubernetes.NewClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case allNamespaces:
+		namespace = ""
+	case namespace == "":
+		namespace = current
+	}
+	in, err := migration.FromCluster(ctx, c, namespace)
+	return c, in, err
+}
@@ -0,0 +1,144 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DeployedPartialsKey is the key of the endpoints in the partials ConfigMap of the chart
+	DeployedPartialsKey = "endpoints.tmpl"
+	// DeployedIndexKey is the key of the index of the partial files of the ApiEndpoints in the partials ConfigMap
+	// deployed by the operator
+	DeployedIndexKey = "endpoints_index.json"
+	// deployedShardLabel is set on the shards of the partials ConfigMap to the name of the Krakend
+	deployedShardLabel = "krakend.nais.io/partials-of"
+)
+
+// DeployedPartialsName is the name of the partials ConfigMap deployed by the operator for the Krakend
+func DeployedPartialsName(krakend string) string {
+	return fmt.Sprintf("%s-krakend-partials", krakend)
+}
+
+// Diff compares the endpoints generated for the Krakend with the endpoints in the partials ConfigMap deployed by the
+// operator. Endpoints only generated are prefixed with +, only deployed with -, and changed with ~ followed by the
+// differences. The diff is empty if the endpoints are the same.
+func Diff(ctx context.Context, c client.Client, o Output) (string, error) {
+	deployed, err := deployedEndpoints(ctx, c, o)
+	if err != nil {
+		return "", err
+	}
+	return diffEndpoints(o.Partials, deployed)
+}
+
+// deployedEndpoints returns the endpoints deployed by the operator, joined from the partial files listed in the index,
+// which are in the partials ConfigMap or its shards
+func deployedEndpoints(ctx context.Context, c client.Client, o Output) (string, error) {
+	cm := &corev1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: o.Namespace, Name: DeployedPartialsName(o.Name)}, cm)
+	if apierrors.IsNotFound(err) {
+		return "[]", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting partials ConfigMap of %s/%s: %w", o.Namespace, o.Name, err)
+	}
+	index, ok := cm.Data[DeployedIndexKey]
+	if !ok {
+		if cm.Data[DeployedPartialsKey] == "" {
+			return "[]", nil
+		}
+		return cm.Data[DeployedPartialsKey], nil
+	}
+
+	shards := &corev1.ConfigMapList{}
+	if err := c.List(ctx, shards, client.InNamespace(o.Namespace), client.MatchingLabels{deployedShardLabel: o.Name}); err != nil {
+		return "", fmt.Errorf("listing partials shards of %s/%s: %w", o.Namespace, o.Name, err)
+	}
+	files := make(map[string]string)
+	for _, m := range append([]corev1.ConfigMap{*cm}, shards.Items...) {
+		for name, content := range m.Data {
+			files[name] = content
+		}
+	}
+
+	names := make([]string, 0)
+	if err := json.Unmarshal([]byte(index), &names); err != nil {
+		return "", fmt.Errorf("parsing index of %s/%s: %w", o.Namespace, o.Name, err)
+	}
+	endpoints := make([]json.RawMessage, 0)
+	for _, name := range names {
+		file := make([]json.RawMessage, 0)
+		if err := json.Unmarshal([]byte(files[name]), &file); err != nil {
+			return "", fmt.Errorf("parsing partial file %s of %s/%s: %w", name, o.Namespace, o.Name, err)
+		}
+		endpoints = append(endpoints, file...)
+	}
+	b, err := json.Marshal(endpoints)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// diffEndpoints compares the endpoints by method and path, ignoring formatting and order
+func diffEndpoints(generated, deployed string) (string, error) {
+	g, err := endpointsByRoute(generated)
+	if err != nil {
+		return "", fmt.Errorf("parsing generated endpoints: %w", err)
+	}
+	d, err := endpointsByRoute(deployed)
+	if err != nil {
+		return "", fmt.Errorf("parsing deployed endpoints: %w", err)
+	}
+
+	routes := make([]string, 0)
+	for r := range g {
+		routes = append(routes, r)
+	}
+	for r := range d {
+		if _, ok := g[r]; !ok {
+			routes = append(routes, r)
+		}
+	}
+	sort.Strings(routes)
+
+	var b strings.Builder
+	for _, r := range routes {
+		ge, inGenerated := g[r]
+		de, inDeployed := d[r]
+		switch {
+		case !inDeployed:
+			fmt.Fprintf(&b, "+ %s\n", r)
+		case !inGenerated:
+			fmt.Fprintf(&b, "- %s\n", r)
+		case !reflect.DeepEqual(ge, de):
+			fmt.Fprintf(&b, "~ %s\n", r)
+			for _, line := range strings.Split(strings.TrimRight(cmp.Diff(de, ge), "\n"), "\n") {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+func endpointsByRoute(partials string) (map[string]map[string]any, error) {
+	endpoints := make([]map[string]any, 0)
+	if err := json.Unmarshal([]byte(partials), &endpoints); err != nil {
+		return nil, err
+	}
+	byRoute := make(map[string]map[string]any)
+	for _, e := range endpoints {
+		byRoute[fmt.Sprintf("%v %v", e["method"], e["endpoint"])] = e
+	}
+	return byRoute, nil
+}
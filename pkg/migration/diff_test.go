@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDiffEndpoints(t *testing.T) {
+	generated := `[
+  {"endpoint": "/app1/users", "method": "GET", "timeout": "2s"},
+  {"endpoint": "/app1/users", "method": "POST", "timeout": "2s"},
+  {"endpoint": "/app2", "method": "GET"}
+]`
+	deployed := `[{"endpoint":"/app2","method":"GET"},{"endpoint":"/app1/users","method":"GET","timeout":"3s"},{"endpoint":"/old","method":"GET"}]`
+
+	d, err := diffEndpoints(generated, deployed)
+	assert.NoError(t, err)
+	assert.Contains(t, d, "~ GET /app1/users\n")
+	assert.Contains(t, d, `string("3s")`)
+	assert.Contains(t, d, `string("2s")`)
+	assert.Contains(t, d, "- GET /old\n")
+	assert.Contains(t, d, "+ POST /app1/users\n")
+	assert.NotContains(t, d, "/app2")
+
+	d, err = diffEndpoints(generated, generated)
+	assert.NoError(t, err)
+	assert.Empty(t, d)
+
+	_, err = diffEndpoints(generated, "{{ invalid")
+	assert.ErrorContains(t, err, "parsing deployed endpoints")
+}
+
+func TestDiff(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "team1-krakend-partials", Namespace: "team1"},
+		Data:       map[string]string{DeployedPartialsKey: `[{"endpoint":"/app1","method":"GET"}]`},
+	}
+	c := fake.NewClientBuilder().WithObjects(cm).Build()
+
+	d, err := Diff(context.Background(), c, Output{Namespace: "team1", Name: "team1", Partials: `[{"endpoint":"/app1","method":"GET"}]`})
+	assert.NoError(t, err)
+	assert.Empty(t, d)
+
+	// all endpoints are new if the operator has not deployed the partials
+	d, err = Diff(context.Background(), c, Output{Namespace: "team2", Name: "team2", Partials: `[{"endpoint":"/app2","method":"GET"}]`})
+	assert.NoError(t, err)
+	assert.Equal(t, "+ GET /app2\n", d)
+
+	// the operator stores a partial file per ApiEndpoints, listed in the index, in the partials ConfigMap or its shards
+	indexed := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "team3-krakend-partials", Namespace: "team3"},
+		Data: map[string]string{
+			DeployedPartialsKey:      "[]",
+			DeployedIndexKey:         `["apiendpoints_app1.json","apiendpoints_app2.json"]`,
+			"apiendpoints_app1.json": `[{"endpoint":"/app1","method":"GET"}]`,
+		},
+	}
+	shard := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "team3-krakend-partials-1", Namespace: "team3", Labels: map[string]string{deployedShardLabel: "team3"}},
+		Data:       map[string]string{"apiendpoints_app2.json": `[{"endpoint":"/app2","method":"GET"}]`},
+	}
+	c = fake.NewClientBuilder().WithObjects(indexed, shard).Build()
+	d, err = Diff(context.Background(), c, Output{Namespace: "team3", Name: "team3", Partials: `[{"endpoint":"/app1","method":"GET"},{"endpoint":"/app3","method":"GET"}]`})
+	assert.NoError(t, err)
+	assert.Equal(t, "- GET /app2\n+ GET /app3\n", d)
+}
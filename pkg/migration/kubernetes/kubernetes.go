@@ -1,43 +1,45 @@
 package kubernetes
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+
 	krakendv1 "github.com/nais/krakend/api/v1"
-	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
-	"os"
-	"path/filepath"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func NewClient() (client.Client, string) {
+// NewClient returns a client for the current context of the kubeconfig, and the namespace of the context
+func NewClient() (client.Client, string, error) {
 	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath()},
 		&clientcmd.ConfigOverrides{},
 	)
 	restCfg, err := cc.ClientConfig()
 	if err != nil {
-		log.Fatalf("kubeconfig: %v", err)
+		return nil, "", fmt.Errorf("kubeconfig: %w", err)
 	}
 	scheme := runtime.NewScheme()
 	if err := krakendv1.AddToScheme(scheme); err != nil {
-		log.Fatalf("scheme: %v", err)
+		return nil, "", fmt.Errorf("scheme: %w", err)
 	}
 	if err = v1.AddToScheme(scheme); err != nil {
-		log.Fatalf("scheme: %v", err)
+		return nil, "", fmt.Errorf("scheme: %w", err)
 	}
 	c, err := client.New(restCfg, client.Options{Scheme: scheme})
 	if err != nil {
-		log.Fatalf("client: %v", err)
+		return nil, "", fmt.Errorf("client: %w", err)
 	}
 
 	ns, _, err := cc.Namespace()
 	if err != nil || ns == "" {
 		ns = "default"
 	}
-	return c, ns
+	return c, ns, nil
 }
 
 func kubeconfigPath() string {
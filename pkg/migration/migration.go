@@ -1,37 +1,254 @@
+// Package migration converts Krakends and their ApiEndpoints to NAIS Applications running KrakenD
 package migration
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
 
 	krakendv1 "github.com/nais/krakend/api/v1"
-	"github.com/nais/krakend/pkg/migration/kubernetes"
+	"github.com/nais/krakend/internal/krakend"
 	"github.com/nais/krakend/pkg/migration/parse"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func ConvertKrakends(ctx context.Context) (string, error) {
-	c, ns := kubernetes.NewClient()
+// Input is the Krakends and ApiEndpoints to migrate
+type Input struct {
+	Krakends     []krakendv1.Krakend
+	ApiEndpoints []krakendv1.ApiEndpoints
+}
+
+// Output is the resources converted from a single Krakend, as a multi document YAML
+type Output struct {
+	Namespace string
+	Name      string
+	YAML      string
+	// Partials are the endpoints rendered for the Krakend, as in the partials ConfigMap
+	Partials string
+}
+
+// FileName is the name of the file the output of the Krakend is written to
+func (o Output) FileName() string {
+	return fmt.Sprintf("%s-%s.yaml", o.Namespace, o.Name)
+}
+
+// Skipped is an ApiEndpoints which is not migrated with any Krakend
+type Skipped struct {
+	Namespace string
+	Name      string
+	Reason    string
+}
+
+func (s Skipped) String() string {
+	return fmt.Sprintf("%s/%s: %s", s.Namespace, s.Name, s.Reason)
+}
+
+// Result is the outcome of converting the Krakends and ApiEndpoints of an Input
+type Result struct {
+	Outputs []Output
+	Skipped []Skipped
+}
+
+// FromCluster lists the Krakends and ApiEndpoints in the namespace, or in all namespaces if namespace is empty
+func FromCluster(ctx context.Context, c client.Client, namespace string) (*Input, error) {
+	opts := make([]client.ListOption, 0)
+	if namespace != "" {
+		opts = append(opts, client.InNamespace(namespace))
+	}
 
 	krakends := &krakendv1.KrakendList{}
-	err := c.List(ctx, krakends, client.InNamespace(ns))
-	if err != nil {
-		return "", fmt.Errorf("listing krakends: %v", err)
+	if err := c.List(ctx, krakends, opts...); err != nil {
+		return nil, fmt.Errorf("listing krakends: %w", err)
 	}
 	apiEndpoints := &krakendv1.ApiEndpointsList{}
-	err = c.List(ctx, apiEndpoints, client.InNamespace(ns))
+	if err := c.List(ctx, apiEndpoints, opts...); err != nil {
+		return nil, fmt.Errorf("listing apiendpoints: %w", err)
+	}
+	return &Input{Krakends: krakends.Items, ApiEndpoints: apiEndpoints.Items}, nil
+}
+
+// FromFiles reads the Krakends and ApiEndpoints in the files, or in the YAML files of directories, e.g. as exported
+// with kubectl get -o yaml. Lists are expanded, and resources without a namespace are placed in namespace.
+func FromFiles(paths []string, namespace string) (*Input, error) {
+	files, err := manifestFiles(paths)
 	if err != nil {
-		return "", fmt.Errorf("listing apiendpoints: %v", err)
+		return nil, err
+	}
+	in := &Input{}
+	for _, file := range files {
+		objs, err := readObjects(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(namespace)
+			}
+			switch obj.GetKind() {
+			case "Krakend":
+				k := krakendv1.Krakend{}
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &k); err != nil {
+					return nil, fmt.Errorf("%s: decoding krakend %s: %w", file, obj.GetName(), err)
+				}
+				in.Krakends = append(in.Krakends, k)
+			case "ApiEndpoints":
+				a := krakendv1.ApiEndpoints{}
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &a); err != nil {
+					return nil, fmt.Errorf("%s: decoding apiendpoints %s: %w", file, obj.GetName(), err)
+				}
+				in.ApiEndpoints = append(in.ApiEndpoints, a)
+			}
+		}
 	}
+	return in, nil
+}
+
+// Convert converts each Krakend, ordered by namespace and name, with the ApiEndpoints targeting it. The ApiEndpoints
+// are resolved as by the operator, by spec.krakend in the same namespace, defaulting to the name of the namespace, and
+// their auth providers in the Krakend or the catalogue.
+func Convert(in *Input, catalogue krakend.AuthProviderCatalogue) (*Result, error) {
+	krakends := append([]krakendv1.Krakend{}, in.Krakends...)
+	sort.Slice(krakends, func(i, j int) bool {
+		if krakends[i].Namespace != krakends[j].Namespace {
+			return krakends[i].Namespace < krakends[j].Namespace
+		}
+		return krakends[i].Name < krakends[j].Name
+	})
 
-	objs := make([]runtime.Object, 0)
-	for _, k := range krakends.Items {
-		o, err := parse.Convert(&k, apiEndpoints.Items)
+	result := &Result{
+		Outputs: make([]Output, 0),
+		Skipped: skippedApiEndpoints(krakends, in.ApiEndpoints),
+	}
+	for _, k := range krakends {
+		endpoints := apiEndpointsForKrakend(&k, in.ApiEndpoints)
+		objs, err := parse.Convert(&k, catalogue, endpoints)
+		if err != nil {
+			return nil, fmt.Errorf("converting krakend %s/%s: %w", k.Namespace, k.Name, err)
+		}
+		out, err := parse.ToYAML(objs...)
+		if err != nil {
+			return nil, fmt.Errorf("serializing krakend %s/%s: %w", k.Namespace, k.Name, err)
+		}
+		result.Outputs = append(result.Outputs, Output{
+			Namespace: k.Namespace,
+			Name:      k.Name,
+			YAML:      out,
+			Partials:  partials(objs),
+		})
+	}
+	return result, nil
+}
+
+// apiEndpointsForKrakend returns the ApiEndpoints targeting the Krakend, as selected by the operator
+func apiEndpointsForKrakend(k *krakendv1.Krakend, list []krakendv1.ApiEndpoints) []krakendv1.ApiEndpoints {
+	filtered := make([]krakendv1.ApiEndpoints, 0)
+	for _, e := range list {
+		if e.GetDeletionTimestamp() == nil && e.Namespace == k.Namespace && e.KrakendName() == k.Name {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// skippedApiEndpoints returns the ApiEndpoints not targeting any of the Krakends, with the reason
+func skippedApiEndpoints(krakends []krakendv1.Krakend, list []krakendv1.ApiEndpoints) []Skipped {
+	exists := make(map[string]bool)
+	for _, k := range krakends {
+		exists[k.Namespace+"/"+k.Name] = true
+	}
+	skipped := make([]Skipped, 0)
+	for _, e := range list {
+		switch {
+		case e.GetDeletionTimestamp() != nil:
+			skipped = append(skipped, Skipped{Namespace: e.Namespace, Name: e.Name, Reason: "is being deleted"})
+		case !exists[e.Namespace+"/"+e.KrakendName()]:
+			skipped = append(skipped, Skipped{Namespace: e.Namespace, Name: e.Name, Reason: fmt.Sprintf("Krakend %s/%s not found", e.Namespace, e.KrakendName())})
+		}
+	}
+	return skipped
+}
+
+func partials(objs []runtime.Object) string {
+	for _, obj := range objs {
+		if cm, ok := obj.(*corev1.ConfigMap); ok {
+			if p, ok := cm.Data[parse.ConfigMapEndpointsKey]; ok {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// manifestFiles returns the files, and the YAML files in directories, in lexical order per directory
+func manifestFiles(paths []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches := make([]string, 0)
+		err = filepath.WalkDir(p, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && (filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml") {
+				matches = append(matches, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+func readObjects(file string) ([]*unstructured.Unstructured, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	objs := make([]*unstructured.Unstructured, 0)
+	decoder := yamlutil.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		err := decoder.Decode(&obj.Object)
+		if errors.Is(err, io.EOF) {
+			return objs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if obj.Object == nil {
+			continue
+		}
+		if !obj.IsList() {
+			objs = append(objs, obj)
+			continue
+		}
+		err = obj.EachListItem(func(item runtime.Object) error {
+			objs = append(objs, item.(*unstructured.Unstructured))
+			return nil
+		})
 		if err != nil {
-			return "", fmt.Errorf("converting krakend %s: %v", k.Name, err)
+			return nil, fmt.Errorf("%s: %w", file, err)
 		}
-		objs = append(objs, o...)
 	}
-	return parse.ToYAML(objs...)
 }
@@ -0,0 +1,49 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromFiles(t *testing.T) {
+	in, err := FromFiles([]string{"testdata"}, "team2")
+	assert.NoError(t, err)
+
+	assert.Len(t, in.Krakends, 2)
+	assert.Equal(t, "team1", in.Krakends[0].Name)
+	assert.Equal(t, "team2", in.Krakends[1].Namespace)
+	assert.Len(t, in.ApiEndpoints, 3)
+	assert.Equal(t, "app1", in.ApiEndpoints[0].Name)
+	assert.Equal(t, "team1", in.ApiEndpoints[1].Namespace)
+}
+
+func TestConvert(t *testing.T) {
+	in, err := FromFiles([]string{"testdata"}, "team2")
+	assert.NoError(t, err)
+
+	result, err := Convert(in, nil)
+	assert.NoError(t, err)
+	assert.Len(t, result.Outputs, 2)
+
+	team1 := result.Outputs[0]
+	assert.Equal(t, "team1-team1.yaml", team1.FileName())
+	assert.Contains(t, team1.YAML, "kind: Application")
+	assert.Contains(t, team1.YAML, "name: team1-gw-partials")
+	assert.Contains(t, team1.Partials, "/app1/users")
+	assert.Contains(t, team1.YAML, "application: app1")
+	// ApiEndpoints are resolved by spec.krakend, not by owner references set by the operator
+	assert.Contains(t, team1.Partials, "/app2")
+	assert.Contains(t, team1.YAML, "host: app2.example.com")
+	assert.NotContains(t, team1.Partials, "/app3")
+	assert.NotContains(t, team1.YAML, "application: app3")
+
+	team2 := result.Outputs[1]
+	assert.Equal(t, "team2-team2.yaml", team2.FileName())
+	assert.Contains(t, team2.YAML, "https://team2.nais.io")
+	assert.NotContains(t, team2.YAML, "app2.example.com")
+
+	assert.Equal(t, []Skipped{
+		{Namespace: "team1", Name: "app3", Reason: "Krakend team1/doesnotexist not found"},
+	}, result.Skipped)
+}
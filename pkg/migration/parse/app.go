@@ -4,41 +4,48 @@ import (
 	"embed"
 	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
 
 	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/krakend"
 	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
 	nais_io_v1alpha1 "github.com/nais/liberator/pkg/apis/nais.io/v1alpha1"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
 const (
 	AppTemplateFile = "templates/app.yaml"
-	DefaultImage    = "krakend:2.12.0"
+	DefaultImage    = DefaultRepository + ":" + DefaultTag
+	// DefaultRepository and DefaultTag are used for the parts of the image not configured in the Krakend
+	DefaultRepository = "krakend"
+	DefaultTag        = "2.12.0"
+	// naisMaxReplicas is the maximum replicas of an Application when not configured
+	naisMaxReplicas = 4
 )
 
+var binaryMemoryPattern = regexp.MustCompile(`^\d+[KMG]i$`)
+
 //go:embed templates/*.yaml
 var templatesDir embed.FS
 
-func Convert(k *krakendv1.Krakend, endpoints []krakendv1.ApiEndpoints) ([]runtime.Object, error) {
+// Convert converts the Krakend to an Application with ConfigMaps for the config and the endpoints, endpoints must be the
+// ApiEndpoints targeting the Krakend. Auth providers not defined in the Krakend are taken from the catalogue.
+func Convert(k *krakendv1.Krakend, catalogue krakend.AuthProviderCatalogue, endpoints []krakendv1.ApiEndpoints) ([]runtime.Object, error) {
 	objs := make([]runtime.Object, 0)
-	app := ToApp(k, endpoints)
+	app, err := ToApp(k, catalogue, endpoints)
+	if err != nil {
+		return nil, err
+	}
 	config, err := ToKrakendConfig(k)
 	if err != nil {
 		return nil, fmt.Errorf("creating krakend config configmap: %v", err)
 	}
 
-	filtered := make([]krakendv1.ApiEndpoints, 0)
-	for _, e := range endpoints {
-		for _, ref := range e.OwnerReferences {
-			if ref.UID == k.UID {
-				filtered = append(filtered, e)
-			}
-		}
-	}
-
-	partials, err := ToPartialsConfig(k, filtered)
+	partials, err := ToPartialsConfig(k, catalogue, endpoints)
 	if err != nil {
 		return nil, fmt.Errorf("creating partials config configmap: %v", err)
 	}
@@ -47,16 +54,18 @@ func Convert(k *krakendv1.Krakend, endpoints []krakendv1.ApiEndpoints) ([]runtim
 	return objs, nil
 }
 
-func ToApp(k *krakendv1.Krakend, endpoints []krakendv1.ApiEndpoints) *nais_io_v1alpha1.Application {
+func ToApp(k *krakendv1.Krakend, catalogue krakend.AuthProviderCatalogue, endpoints []krakendv1.ApiEndpoints) (*nais_io_v1alpha1.Application, error) {
 	app := &nais_io_v1alpha1.Application{}
 	err := ParseYaml(templatesDir, AppTemplateFile, app)
 	if err != nil {
-		log.Fatalf("parsing application template: %v", err)
+		return nil, fmt.Errorf("parsing application template: %v", err)
 	}
 
 	app.Name = resourceName(k)
 	app.Namespace = k.Namespace
-	app.Spec.Image = DefaultImage
+	app.Spec.Image = image(k.Spec.Deployment.Image)
+	app.Spec.Resources = resources(k.Spec.Deployment.Resources)
+	app.Spec.Env = append(app.Spec.Env, envVars(k.Spec.Deployment.ExtraEnvVars)...)
 
 	ingresses := getIngresses(k)
 	for _, ingress := range ingresses {
@@ -66,9 +75,12 @@ func ToApp(k *krakendv1.Krakend, endpoints []krakendv1.ApiEndpoints) *nais_io_v1
 	}
 
 	app.Spec.Ingresses = ingresses
+	// the Krakend has no autoscaling settings to carry over, so the Application keeps the autoscaling of NAIS with
+	// the replicas of the Krakend as the minimum, raising the maximum if needed
 	if k.Spec.Deployment.ReplicaCount > 0 {
-		app.Spec.Replicas = &nais_io_v1.Replicas{
-			Min: &k.Spec.Deployment.ReplicaCount,
+		app.Spec.Replicas = &nais_io_v1.Replicas{Min: &k.Spec.Deployment.ReplicaCount}
+		if k.Spec.Deployment.ReplicaCount > naisMaxReplicas {
+			app.Spec.Replicas.Max = &k.Spec.Deployment.ReplicaCount
 		}
 	}
 	app.Spec.FilesFrom = []nais_io_v1.FilesFrom{
@@ -82,7 +94,7 @@ func ToApp(k *krakendv1.Krakend, endpoints []krakendv1.ApiEndpoints) *nais_io_v1
 		},
 	}
 
-	egressesFromAuth := getEgressesFromAuth(k)
+	egressesFromAuth := getEgressesFromAuth(k, catalogue)
 	if len(egressesFromAuth) > 0 {
 		app.Spec.AccessPolicy = &nais_io_v1.AccessPolicy{}
 		app.Spec.AccessPolicy.Outbound = &nais_io_v1.AccessPolicyOutbound{}
@@ -121,7 +133,84 @@ func ToApp(k *krakendv1.Krakend, endpoints []krakendv1.ApiEndpoints) *nais_io_v1
 		}
 	}
 
-	return app
+	return app, nil
+}
+
+// image returns the image of the Krakend, using the default repository and tag for the parts not configured
+func image(i krakendv1.Image) string {
+	if i.Repository == "" && i.Tag == "" {
+		return DefaultImage
+	}
+	repository := DefaultRepository
+	if i.Repository != "" {
+		repository = i.Repository
+	}
+	if i.Registry != "" {
+		repository = i.Registry + "/" + repository
+	}
+	tag := DefaultTag
+	if i.Tag != "" {
+		tag = i.Tag
+	}
+	return repository + ":" + tag
+}
+
+// resources converts the resource requirements of the deployment, NAIS only supports cpu and memory
+func resources(r corev1.ResourceRequirements) *nais_io_v1.ResourceRequirements {
+	if len(r.Limits) == 0 && len(r.Requests) == 0 {
+		return nil
+	}
+	return &nais_io_v1.ResourceRequirements{
+		Limits:   resourceSpec(r.Limits),
+		Requests: resourceSpec(r.Requests),
+	}
+}
+
+func resourceSpec(l corev1.ResourceList) *nais_io_v1.ResourceSpec {
+	cpu, hasCpu := l[corev1.ResourceCPU]
+	memory, hasMemory := l[corev1.ResourceMemory]
+	if !hasCpu && !hasMemory {
+		return nil
+	}
+	spec := &nais_io_v1.ResourceSpec{}
+	if hasCpu {
+		// the canonical form is either whole cores or millicores, e.g. 0.5 is 500m
+		spec.Cpu = cpu.String()
+	}
+	if hasMemory {
+		spec.Memory = memoryString(memory)
+	}
+	return spec
+}
+
+// memoryString returns the memory with a binary suffix, as required by NAIS, rounding decimal quantities up to Mi
+func memoryString(q resource.Quantity) string {
+	if s := q.String(); binaryMemoryPattern.MatchString(s) {
+		return s
+	}
+	const mi = 1024 * 1024
+	return fmt.Sprintf("%dMi", (q.Value()+mi-1)/mi)
+}
+
+// envVars converts the extra env vars of the deployment, NAIS only supports values and field references
+func envVars(vars []corev1.EnvVar) nais_io_v1.EnvVars {
+	env := make(nais_io_v1.EnvVars, 0)
+	for _, v := range vars {
+		switch {
+		case v.ValueFrom == nil:
+			env = append(env, nais_io_v1.EnvVar{Name: v.Name, Value: v.Value})
+		case v.ValueFrom.FieldRef != nil:
+			env = append(env, nais_io_v1.EnvVar{
+				Name: v.Name,
+				ValueFrom: &nais_io_v1.EnvVarSource{
+					FieldRef: nais_io_v1.ObjectFieldSelector{FieldPath: v.ValueFrom.FieldRef.FieldPath},
+				},
+			})
+		default:
+			log.Warnf("env var %s is set from a secret, config map or resource, which is not supported by NAIS Applications, use envFrom instead", v.Name)
+		}
+	}
+	return env
 }
 
 type Egress struct {
@@ -129,9 +218,9 @@ type Egress struct {
 	ExternalHost string
 }
 
-func getEgressesFromAuth(k *krakendv1.Krakend) []*Egress {
+func getEgressesFromAuth(k *krakendv1.Krakend, catalogue krakend.AuthProviderCatalogue) []*Egress {
 	egresses := make([]*Egress, 0)
-	for _, a := range k.Spec.AuthProviders {
+	for _, a := range catalogue.AuthProviders(k) {
 		u, err := url.Parse(a.JwkUrl)
 		if err != nil {
 			continue
@@ -148,30 +237,34 @@ func getEgresses(endpoints ...krakendv1.ApiEndpoints) []*Egress {
 	seen := make(map[string]bool)
 	egresses := make([]*Egress, 0)
 	for _, ep := range endpoints {
-		for _, e := range ep.Spec.Endpoints {
-			u, err := url.Parse(e.BackendHost)
-			if err != nil {
-				log.Warnf("failed to parse backend host %s in ApiEndpoints %s, skipping: %v", e.BackendHost, ep.Name, err)
-				continue
-			}
-			// only support http for service discovery
-			if u.Scheme == "http" && u.Hostname() != "" {
-				parts := strings.Split(u.Hostname(), ".")
-				app := ""
-				if len(parts) > 0 {
-					app = parts[0]
+		// open endpoints are routed to their backends as well
+		all := append(append([]krakendv1.Endpoint{}, ep.Spec.Endpoints...), ep.Spec.OpenEndpoints...)
+		for _, e := range all {
+			for _, host := range e.AllBackendHosts() {
+				u, err := url.Parse(host)
+				if err != nil {
+					log.Warnf("failed to parse backend host %s in ApiEndpoints %s, skipping: %v", host, ep.Name, err)
+					continue
 				}
+				// only support http for service discovery
+				if u.Scheme == "http" && u.Hostname() != "" {
+					parts := strings.Split(u.Hostname(), ".")
+					app := ""
+					if len(parts) > 0 {
+						app = parts[0]
+					}
 
-				if _, ok := seen[app]; !ok && app != "" {
-					seen[app] = true
-					egresses = append(egresses, &Egress{App: app})
+					if _, ok := seen[app]; !ok && app != "" {
+						seen[app] = true
+						egresses = append(egresses, &Egress{App: app})
+					}
+					continue
 				}
-				continue
-			}
-			if u.Hostname() != "" {
-				if _, ok := seen[u.Hostname()]; !ok {
-					seen[u.Hostname()] = true
-					egresses = append(egresses, &Egress{ExternalHost: u.Hostname()})
+				if u.Hostname() != "" {
+					if _, ok := seen[u.Hostname()]; !ok {
+						seen[u.Hostname()] = true
+						egresses = append(egresses, &Egress{ExternalHost: u.Hostname()})
+					}
 				}
 			}
 		}
@@ -0,0 +1,150 @@
+package parse
+
+import (
+	"testing"
+
+	krakendv1 "github.com/nais/krakend/api/v1"
+	"github.com/nais/krakend/internal/krakend"
+	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestToAppDeployment(t *testing.T) {
+	k := &krakendv1.Krakend{
+		ObjectMeta: metav1.ObjectMeta{Name: "team1", Namespace: "team1"},
+		Spec: krakendv1.KrakendSpec{
+			Deployment: krakendv1.KrakendDeployment{
+				ReplicaCount: 3,
+				Image: krakendv1.Image{
+					Registry:   "europe-north1-docker.pkg.dev",
+					Repository: "nais-io/krakend",
+					Tag:        "2.10.0",
+				},
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("1G"),
+					},
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("0.5"),
+						corev1.ResourceMemory: resource.MustParse("256Mi"),
+					},
+				},
+				ExtraEnvVars: []corev1.EnvVar{
+					{Name: "LOG_LEVEL", Value: "debug"},
+					{Name: "POD_IP", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"}}},
+					{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "token"}}},
+				},
+			},
+		},
+	}
+
+	app, err := ToApp(k, nil, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "europe-north1-docker.pkg.dev/nais-io/krakend:2.10.0", app.Spec.Image)
+
+	three := 3
+	assert.Equal(t, &nais_io_v1.Replicas{Min: &three}, app.Spec.Replicas)
+
+	assert.Equal(t, &nais_io_v1.ResourceRequirements{
+		Limits:   &nais_io_v1.ResourceSpec{Memory: "954Mi"},
+		Requests: &nais_io_v1.ResourceSpec{Cpu: "500m", Memory: "256Mi"},
+	}, app.Spec.Resources)
+
+	// the env vars of the template are kept, and secret references are skipped
+	names := make([]string, 0)
+	for _, e := range app.Spec.Env {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"USAGE_DISABLE", "FC_ENABLE", "FC_PARTIALS", "LOG_LEVEL", "POD_IP"}, names)
+	assert.Equal(t, "status.podIP", app.Spec.Env[4].ValueFrom.FieldRef.FieldPath)
+}
+
+func TestToAppReplicasAboveNaisMax(t *testing.T) {
+	k := &krakendv1.Krakend{ObjectMeta: metav1.ObjectMeta{Name: "team1", Namespace: "team1"}}
+	k.Spec.Deployment.ReplicaCount = 6
+
+	app, err := ToApp(k, nil, nil)
+	assert.NoError(t, err)
+
+	six := 6
+	assert.Equal(t, &nais_io_v1.Replicas{Min: &six, Max: &six}, app.Spec.Replicas)
+	assert.False(t, app.Spec.Replicas.DisableAutoScaling)
+}
+
+func TestToAppDefaults(t *testing.T) {
+	k := &krakendv1.Krakend{ObjectMeta: metav1.ObjectMeta{Name: "team1", Namespace: "team1"}}
+
+	app, err := ToApp(k, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultImage, app.Spec.Image)
+	assert.Nil(t, app.Spec.Replicas)
+	assert.Nil(t, app.Spec.Resources)
+	assert.Len(t, app.Spec.Env, 3)
+}
+
+func TestToAppAuthProviderEgress(t *testing.T) {
+	k := &krakendv1.Krakend{
+		ObjectMeta: metav1.ObjectMeta{Name: "team1", Namespace: "team1"},
+		Spec: krakendv1.KrakendSpec{
+			AuthProviders: []krakendv1.AuthProvider{{Name: "maskinporten", JwkUrl: "https://test.maskinporten.no/jwk"}},
+		},
+	}
+	catalogue := krakend.AuthProviderCatalogue{
+		{Name: "maskinporten", JwkUrl: "https://maskinporten.no/jwk"},
+		{Name: "tokenx", JwkUrl: "https://tokenx.nais.io/jwks"},
+	}
+
+	// the Krakend overrides the auth providers of the catalogue
+	app, err := ToApp(k, catalogue, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []nais_io_v1.AccessPolicyExternalRule{
+		{Host: "test.maskinporten.no"},
+		{Host: "tokenx.nais.io"},
+	}, app.Spec.AccessPolicy.Outbound.External)
+}
+
+func TestToAppBackendEgress(t *testing.T) {
+	k := &krakendv1.Krakend{ObjectMeta: metav1.ObjectMeta{Name: "team1", Namespace: "team1"}}
+	endpoints := krakendv1.ApiEndpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "app1", Namespace: "team1"},
+		Spec: krakendv1.ApiEndpointsSpec{
+			Endpoints: []krakendv1.Endpoint{
+				{Path: "/single", BackendHost: "http://app1"},
+				{
+					Path: "/aggregated",
+					// BackendHost is ignored when backends are specified
+					BackendHost: "http://ignored",
+					Backends: []krakendv1.Backend{
+						{Hosts: []string{"http://app2.team1", "http://app3"}},
+						{Hosts: []string{"https://api.example.com", "http://app2.team1.svc.cluster.local"}},
+					},
+				},
+			},
+			OpenEndpoints: []krakendv1.Endpoint{
+				{Path: "/open", Backends: []krakendv1.Backend{{Hosts: []string{"https://other.example.com"}}}},
+			},
+		},
+	}
+
+	app, err := ToApp(k, nil, []krakendv1.ApiEndpoints{endpoints})
+	assert.NoError(t, err)
+	assert.Equal(t, nais_io_v1.AccessPolicyRules{
+		{Application: "app1"},
+		{Application: "app2"},
+		{Application: "app3"},
+	}, app.Spec.AccessPolicy.Outbound.Rules)
+	assert.Equal(t, []nais_io_v1.AccessPolicyExternalRule{
+		{Host: "api.example.com"},
+		{Host: "other.example.com"},
+	}, app.Spec.AccessPolicy.Outbound.External)
+}
+
+func TestImage(t *testing.T) {
+	assert.Equal(t, "krakend:2.12.0", image(krakendv1.Image{}))
+	assert.Equal(t, "krakend:2.11.0", image(krakendv1.Image{Tag: "2.11.0"}))
+	assert.Equal(t, "devopsfaith/krakend:2.12.0", image(krakendv1.Image{Repository: "devopsfaith/krakend"}))
+}
@@ -25,7 +25,7 @@ func ToKrakendConfig(k *krakendv1.Krakend) (*corev1.ConfigMap, error) {
 	return cm, nil
 }
 
-func ToPartialsConfig(k *krakendv1.Krakend, list []krakendv1.ApiEndpoints) (*corev1.ConfigMap, error) {
+func ToPartialsConfig(k *krakendv1.Krakend, catalogue krakend.AuthProviderCatalogue, list []krakendv1.ApiEndpoints) (*corev1.ConfigMap, error) {
 	cm := &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ConfigMap",
@@ -39,7 +39,7 @@ func ToPartialsConfig(k *krakendv1.Krakend, list []krakendv1.ApiEndpoints) (*cor
 	cm.Annotations = map[string]string{}
 	cm.Annotations["reloader.stakater.com/match"] = "true"
 
-	allEndpoints, err := krakend.ToKrakendEndpoints(k, list)
+	allEndpoints, err := krakend.ToKrakendEndpoints(k, catalogue, list)
 	if err != nil {
 		return nil, fmt.Errorf("convert ApiEndpoints to Krakend endpoints: %v", err)
 	}